@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type hrAlertEvent int
+
+const (
+	hrAlertNone hrAlertEvent = iota
+	hrAlertHigh
+	hrAlertLow
+	hrAlertRecovered
+)
+
+// hrThresholdAlerter tracks heart rate against high/low thresholds, with hysteresis
+// so that values hovering around a threshold do not produce repeated alerts.
+// A threshold of 0 disables that side.
+type hrThresholdAlerter struct {
+	lock       sync.Mutex
+	high       float64
+	low        float64
+	hysteresis float64
+
+	state hrAlertEvent // hrAlertNone, hrAlertHigh or hrAlertLow
+}
+
+func newHRThresholdAlerter(high, low, hysteresis float64) *hrThresholdAlerter {
+	return &hrThresholdAlerter{
+		high:       high,
+		low:        low,
+		hysteresis: hysteresis,
+	}
+}
+
+// SetThresholds changes the thresholds, keeping the current alert state.
+func (a *hrThresholdAlerter) SetThresholds(high, low, hysteresis float64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.high, a.low, a.hysteresis = high, low, hysteresis
+}
+
+// Check feeds a new heart rate and returns the event to alert on, if any.
+func (a *hrThresholdAlerter) Check(hr float64) hrAlertEvent {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	switch a.state {
+	case hrAlertHigh:
+		if hr < a.high-a.hysteresis {
+			a.state = hrAlertNone
+			return hrAlertRecovered
+		}
+	case hrAlertLow:
+		if hr > a.low+a.hysteresis {
+			a.state = hrAlertNone
+			return hrAlertRecovered
+		}
+	default:
+		if a.high > 0 && hr >= a.high {
+			a.state = hrAlertHigh
+			return hrAlertHigh
+		}
+		if a.low > 0 && hr <= a.low {
+			a.state = hrAlertLow
+			return hrAlertLow
+		}
+	}
+	return hrAlertNone
+}
+
+// formatHRAlert renders a human-readable alert text for chat-style exporters.
+func formatHRAlert(event hrAlertEvent, data healthData) string {
+	ts := data.Time.Format(time.DateTime)
+	switch event {
+	case hrAlertHigh:
+		return fmt.Sprintf("⚠️ Heart rate high: %d BPM (%s)", data.HeartRate, ts)
+	case hrAlertLow:
+		return fmt.Sprintf("⚠️ Heart rate low: %d BPM (%s)", data.HeartRate, ts)
+	case hrAlertRecovered:
+		return fmt.Sprintf("✅ Heart rate back to normal: %d BPM (%s)", data.HeartRate, ts)
+	default:
+		return ""
+	}
+}
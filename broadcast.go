@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// broadcastSweepInterval is how often subscriptions whose context ended are removed.
+const broadcastSweepInterval = time.Minute
+
+// broadcaster fans out update messages to subscribed clients, and keeps the latest
+// data for clients joining later. It is the one exporter behind all streaming servers
+// (WebSocket, Unix socket, gRPC), so that they share a single fan-out source.
+type broadcaster struct {
+	clients     []*subscription
+	clientsLock sync.Mutex
+
+	data     healthData
+	dataLock sync.RWMutex
+}
+
+// subscription is a client channel, valid until ctx is done or it is unsubscribed.
+type subscription struct {
+	ch  chan *wsUpdateMessage
+	ctx context.Context
+}
+
+func newBroadcaster() *broadcaster {
+	b := &broadcaster{}
+	go func() {
+		for range time.Tick(broadcastSweepInterval) {
+			b.sweep()
+		}
+	}()
+	return b
+}
+
+func (b *broadcaster) Update(data healthData, updatedKey string) error {
+	b.dataLock.Lock()
+	b.data = data
+	b.dataLock.Unlock()
+
+	// Send msg to all connected clients, dropping it for those not keeping up
+	msg := wsUpdateMessage{Data: data, UpdatedKey: updatedKey}
+	b.clientsLock.Lock()
+	for _, s := range b.clients {
+		select {
+		case s.ch <- &msg:
+		default:
+			countDropped(dropStageWSClient)
+		}
+	}
+	b.clientsLock.Unlock()
+	return nil
+}
+
+// Latest returns a copy of the latest data.
+func (b *broadcaster) Latest() healthData {
+	b.dataLock.RLock()
+	defer b.dataLock.RUnlock()
+	return b.data
+}
+
+// Subscribe registers a new client channel with the given buffer size, for as long as ctx
+// is not done. It returns the channel, the number of clients after subscribing, and a function
+// to unsubscribe. Unsubscribing more than once is safe.
+func (b *broadcaster) Subscribe(ctx context.Context, bufSize int) (<-chan *wsUpdateMessage, int, func() int) {
+	s := &subscription{ch: make(chan *wsUpdateMessage, bufSize), ctx: ctx}
+	b.clientsLock.Lock()
+	b.clients = append(b.clients, s)
+	count := len(b.clients)
+	b.clientsLock.Unlock()
+
+	unsubscribe := func() int {
+		b.clientsLock.Lock()
+		defer b.clientsLock.Unlock()
+		b.clients = slices.DeleteFunc(b.clients, func(c *subscription) bool { return c == s })
+		return len(b.clients)
+	}
+	return s.ch, count, unsubscribe
+}
+
+// Clients returns the number of subscribed clients.
+func (b *broadcaster) Clients() int {
+	b.clientsLock.Lock()
+	defer b.clientsLock.Unlock()
+	return len(b.clients)
+}
+
+// sweep removes subscriptions whose context ended without them being unsubscribed,
+// which would otherwise only grow the client list.
+func (b *broadcaster) sweep() {
+	b.clientsLock.Lock()
+	before := len(b.clients)
+	b.clients = slices.DeleteFunc(b.clients, func(s *subscription) bool { return s.ctx.Err() != nil })
+	removed := before - len(b.clients)
+	b.clientsLock.Unlock()
+
+	if removed > 0 {
+		slog.Warn("Removed leaked streaming clients", "count", removed)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestBroadcasterSubscribeChurn(t *testing.T) {
+	b := newBroadcaster()
+	goroutines := runtime.NumGoroutine()
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				ctx, cancel := context.WithCancel(context.Background())
+				_, _, unsubscribe := b.Subscribe(ctx, 1)
+				_ = b.Update(healthData{HeartRate: i}, "heartRate")
+				cancel()
+				// Half the clients leave without unsubscribing, left for the sweep
+				if i%2 == 0 {
+					unsubscribe()
+					unsubscribe()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	b.sweep()
+	if got := b.Clients(); got != 0 {
+		t.Errorf("Clients() = %d after all left, want 0", got)
+	}
+	waitFor(t, "goroutines to exit", func() bool { return runtime.NumGoroutine() <= goroutines })
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig holds the structured sections of the config file.
+// Top-level scalar keys are applied to the flags of the same name instead.
+type fileConfig struct {
+	oscProfiles map[string]yaml.Node
+}
+
+// cmdLineFlags holds the flags given on the command line, which take precedence over the config file.
+var cmdLineFlags map[string]bool
+
+// hotReloadKeys lists the flags that can be changed by reloading the config file.
+// Changes to other keys only take effect after a restart.
+var hotReloadKeys = map[string]bool{
+	"log-level":              true,
+	"osc-ip":                 true,
+	"osc-port":               true,
+	"osc-addr":               true,
+	"osc-hr-float-enabled":   true,
+	"osc-stale-value":        true,
+	"osc-enable-addr":        true,
+	"osc-hr-min":             true,
+	"osc-hr-max":             true,
+	"osc-hr-string-addr":     true,
+	"osc-hr-string-format":   true,
+	"osc-field-addrs":        true,
+	"osc-field-on-stale":     true,
+	"osc-addr-template":      true,
+	"osc-entries":            true,
+	"osc-step-pulse-addr":    true,
+	"osc-steps-per-pulse":    true,
+	"osc-calorie-rate-addr":  true,
+	"osc-calorie-rate-max":   true,
+	"osc-steps-norm-addr":    true,
+	"osc-steps-max":          true,
+	"osc-calories-norm-addr": true,
+	"osc-calories-max":       true,
+	"osc-alarm-addr":         true,
+	"osc-alarm-hr":           true,
+	"osc-alarm-hysteresis":   true,
+	"osc-alarm-cooldown":     true,
+	"alert-hr-high":          true,
+	"alert-hr-low":           true,
+	"alert-hr-hysteresis":    true,
+}
+
+// loadConfig reads the YAML config file at path. Each top-level key names a flag
+// and sets it, unless the flag was given explicitly on the command line.
+func loadConfig(path string) (*fileConfig, error) {
+	return applyConfig(path, false)
+}
+
+// reloadConfig re-reads the config file, applying only the keys in hotReloadKeys
+// and logging other changed keys as requiring a restart.
+func reloadConfig(path string) (*fileConfig, error) {
+	return applyConfig(path, true)
+}
+
+// configStdin as config path reads the config from stdin, once, so it cannot be reloaded.
+const configStdin = "-"
+
+func applyConfig(path string, reload bool) (*fileConfig, error) {
+	var b []byte
+	var err error
+	if path == configStdin {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %v", err)
+	}
+
+	var raw map[string]yaml.Node
+	if err = yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing config file: %v", err)
+	}
+
+	if cmdLineFlags == nil {
+		// Record before the config sets anything, as flag.Visit cannot tell the two apart later
+		cmdLineFlags = make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			cmdLineFlags[f.Name] = true
+		})
+	}
+
+	cfg := &fileConfig{}
+	for key, node := range raw {
+		switch key {
+		case "osc-profiles":
+			if err = node.Decode(&cfg.oscProfiles); err != nil {
+				return nil, fmt.Errorf("parsing osc-profiles: %v", err)
+			}
+			continue
+		}
+
+		f := flag.Lookup(key)
+		if f == nil {
+			return nil, fmt.Errorf("unknown config key %q", key)
+		}
+		if node.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("config key %q must be a scalar value", key)
+		}
+		if cmdLineFlags[key] {
+			continue
+		}
+		if reload && f.Value.String() != node.Value && !hotReloadKeys[key] {
+			slog.Warn("Config change requires restart", "key", key, "current", f.Value.String(), "new", node.Value)
+			continue
+		}
+		if err = flag.Set(key, node.Value); err != nil {
+			return nil, fmt.Errorf("config key %q: %v", key, err)
+		}
+	}
+	return cfg, nil
+}
+
+// watchReload calls apply with the re-read config on each SIGHUP, until ctx is cancelled.
+func watchReload(ctx context.Context, path string, apply func(cfg *fileConfig)) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+			slog.Info("Reloading config", "path", path)
+			cfg, err := reloadConfig(path)
+			if err != nil {
+				slog.Error("Reloading config", "err", err)
+				continue
+			}
+			apply(cfg)
+		}
+	}
+}
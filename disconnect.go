@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// disconnectedKey is passed as updatedKey to exporters once data has gone stale.
+// Exporters not interested in the disconnect simply ignore it like any other key.
+const disconnectedKey = "disconnected"
+
+// disconnectDetector forwards updates to the next exporters, and sends them a
+// disconnectedKey update with the last data once no update arrived for dataStaleAfter.
+type disconnectDetector struct {
+	next []exporter
+
+	lock  sync.Mutex
+	timer *time.Timer
+	last  healthData
+}
+
+func newDisconnectDetector(next []exporter) *disconnectDetector {
+	return &disconnectDetector{next: next}
+}
+
+func (d *disconnectDetector) Update(data healthData, updatedKey string) error {
+	d.lock.Lock()
+	d.last = data
+	if d.timer == nil {
+		d.timer = time.AfterFunc(dataStaleAfter, d.disconnect)
+	} else {
+		d.timer.Reset(dataStaleAfter)
+	}
+	d.lock.Unlock()
+
+	sendToExporters(d.next, data, updatedKey)
+	return nil
+}
+
+func (d *disconnectDetector) disconnect() {
+	d.lock.Lock()
+	data := d.last
+	d.lock.Unlock()
+
+	slog.Info("No data received, notifying exporters of disconnect", "after", dataStaleAfter)
+	sendToExporters(d.next, data, disconnectedKey)
+}
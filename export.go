@@ -1,54 +1,151 @@
 package main
 
 import (
+	"bytes"
+	"compress/flate"
 	"context"
+	"crypto/tls"
+	_ "embed"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/bep/debounce"
 	"github.com/gorilla/websocket"
-	"github.com/hypebeast/go-osc/osc"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/samber/lo"
 )
 
 type exporter interface {
 	Update(data healthData, updatedKey string) error
 }
 
+// dataStaleAfter is how long received data is considered current by exporters.
+// Set from the -data-ttl flag.
+var dataStaleAfter = 30 * time.Second
+
+// isStale reports whether data last received at t is absent or too old to be reported.
+func isStale(t time.Time) bool {
+	return t.IsZero() || time.Since(t) > dataStaleAfter
+}
+
 type nonBlockingExporter struct {
 	exporters []exporter
 }
 
+// httpServerExporter serves data received by hub over HTTP and WebSocket.
 type httpServerExporter struct {
 	upgrader websocket.Upgrader
+	hub      *broadcaster
+
+	// defaultEncoding is used for clients not negotiating an encoding via subprotocol
+	defaultEncoding string
+	// latestMaxAge, if non-zero, is the age after which GET / no longer serves the data
+	latestMaxAge time.Duration
+	// batchInterval, if non-zero, is how long WebSocket updates are collected into one frame
+	batchInterval time.Duration
+	// snapshotInterval, if non-zero, is how often each WebSocket client is re-sent the "all" snapshot
+	snapshotInterval time.Duration
+	// onControl, if set, handles control messages sent by authenticated WebSocket clients.
+	// Set with setOnControl, as the server may already be serving.
+	onControl     func(msg wsControlMessage) error
+	onControlLock sync.RWMutex
+
+	// input, if set, receives the data pushed by WebSocket clients, merged into inputData.
+	// Set with setInput, as the server may already be serving.
+	input     []exporter
+	inputData healthData
+	inputLock sync.Mutex
+}
 
-	clients     []chan *wsUpdateMessage
-	clientsLock sync.Mutex
-
-	data healthData
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "ws-server",
+		description: "HTTP server for the latest data, WebSocket and Server-Sent Events streams, stats and readiness",
+		flags:       []string{"ws-server-enabled", "ws-server-port", "ws-server-encoding", "ws-server-token", "latest-max-age", "dashboard-enabled", "ws-batch-interval", "ws-snapshot-interval", "ws-server-compression"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			latestMaxAge, err := cfg.Duration("latest-max-age")
+			if err != nil {
+				return nil, err
+			}
+			batchInterval, err := cfg.Duration("ws-batch-interval")
+			if err != nil {
+				return nil, err
+			}
+			snapshotInterval, err := cfg.Duration("ws-snapshot-interval")
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("WebSocket server enabled", "port", cfg.Int("port"), "encoding", cfg.String("encoding"))
+			env.wsServer = newHTTPServerExporter(env.broadcaster(), cfg.Int("port"), cfg.String("encoding"), cfg.String("token"), latestMaxAge, batchInterval, snapshotInterval, cfg.Bool("compression"), cfg.Bool("dashboard-enabled"))
+			// Streams from the shared broadcaster
+			return nil, nil
+		},
+	})
+	registerExporter(exporterRegistration{
+		name:        "prom",
+		description: "Prometheus metrics endpoint",
+		flags:       []string{"prom-enabled", "prom-port", "prom-namespace", "prom-go-metrics", "prom-staleness-key", "prom-auth-user", "prom-auth-pass", "prom-tls-cert", "prom-tls-key"},
+		create: func(_ *exporterEnv, cfg exporterConfig) (exporter, error) {
+			if err := validateStalenessKey(cfg.String("staleness-key")); err != nil {
+				return nil, err
+			}
+			slog.Info("Prometheus enabled", "port", cfg.Int("port"))
+			return newPrometheusExporter(cfg.Int("port"), cfg.String("namespace"), cfg.Bool("go-metrics"), cfg.String("staleness-key"), cfg.String("auth-user"), cfg.String("auth-pass"), cfg.String("tls-cert"), cfg.String("tls-key")), nil
+		},
+	})
 }
 
-func newHTTPServerExporter(port int) *httpServerExporter {
+func newHTTPServerExporter(hub *broadcaster, port int, defaultEncoding, token string, latestMaxAge, batchInterval, snapshotInterval time.Duration, compression, dashboard bool) *httpServerExporter {
 	h := &httpServerExporter{
-		upgrader: websocket.Upgrader{},
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{wsEncodingMsgpack, wsEncodingJSON, wsEncodingMsgpack + wsBatchSuffix, wsEncodingJSON + wsBatchSuffix},
+			// Negotiated per client, those not supporting permessage-deflate get uncompressed frames
+			EnableCompression: compression,
+		},
+		hub:              hub,
+		defaultEncoding:  defaultEncoding,
+		latestMaxAge:     latestMaxAge,
+		batchInterval:    batchInterval,
+		snapshotInterval: snapshotInterval,
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("GET /", http.HandlerFunc(h.getLatest))
-	mux.Handle("GET /ws", http.HandlerFunc(h.connectWS))
+	// Checked before upgrading, so that unauthorized clients get a plain 401
+	mux.Handle("GET /ws", tokenAuth(token, http.HandlerFunc(h.connectWS)))
+	mux.Handle("GET /events", tokenAuth(token, http.HandlerFunc(h.streamEvents)))
+	mux.Handle("GET /stats", http.HandlerFunc(serveStats))
+	// Mutating, so only served to authenticated clients, never with authentication disabled
+	if token != "" {
+		mux.Handle("POST /reset", tokenAuth(token, http.HandlerFunc(serveReset)))
+	} else {
+		slog.Info("POST /reset disabled, as it requires -ws-server-token")
+	}
+	mux.Handle("GET /ready", http.HandlerFunc(serveReady))
+	if dashboard {
+		mux.Handle("GET /dashboard", http.HandlerFunc(serveDashboard))
+	}
 
+	// Bind synchronously, so that the port is listening once this returns
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
 	go func() {
 		slog.Info("HTTP exporter listening...", "port", port)
-		if err := http.ListenAndServe(":"+strconv.Itoa(port), mux); err != nil {
+		if err := http.Serve(listener, mux); err != nil {
 			slog.Error(err.Error())
 			os.Exit(1)
 		}
@@ -57,29 +154,24 @@ func newHTTPServerExporter(port int) *httpServerExporter {
 	return h
 }
 
-func (h *httpServerExporter) Update(data healthData, updatedKey string) error {
-	// Send msg to all connected clients
-	msg := wsUpdateMessage{Data: data, UpdatedKey: updatedKey}
-	h.clientsLock.Lock()
-	for _, ch := range h.clients {
-		select {
-		case ch <- &msg:
-		default:
-		}
-	}
-	h.clientsLock.Unlock()
-	return nil
+//go:embed web/dashboard.html
+var dashboardHTML []byte
+
+func serveDashboard(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(dashboardHTML)
 }
 
 func (h *httpServerExporter) getLatest(w http.ResponseWriter, _ *http.Request) {
-	if h.data.Time.IsZero() {
+	data := h.hub.Latest()
+	if data.Time.IsZero() || (h.latestMaxAge > 0 && time.Since(data.Time) > h.latestMaxAge) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(h.data); err != nil {
+	if err := json.NewEncoder(w).Encode(data); err != nil {
 		slog.Error("Serving GET /latest", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -91,33 +183,52 @@ type wsUpdateMessage struct {
 	UpdatedKey string     `json:"updatedKey"`
 }
 
+// wsBatchSuffix on a subprotocol additionally requests batched frames, collected for -ws-batch-interval
+// or else wsDefaultBatchInterval.
+const (
+	wsBatchSuffix          = "-batch"
+	wsDefaultBatchInterval = 100 * time.Millisecond
+)
+
 func (h *httpServerExporter) connectWS(w http.ResponseWriter, r *http.Request) {
+	// Clients requesting subprotocols rely on one of them, so do not silently fall back to the defaults
+	if requested := websocket.Subprotocols(r); len(requested) > 0 && !slices.ContainsFunc(requested, func(p string) bool {
+		return slices.Contains(h.upgrader.Subprotocols, p)
+	}) {
+		http.Error(w, fmt.Sprintf("Unsupported subprotocols %v, supported are %v", requested, h.upgrader.Subprotocols), http.StatusBadRequest)
+		return
+	}
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("Upgrading connection", "err", err)
 		return
 	}
 	defer conn.Close()
+	// The frames are small, so favor CPU over ratio. No-op unless compression was negotiated.
+	_ = conn.SetCompressionLevel(flate.BestSpeed)
 
 	remoteAddr := conn.RemoteAddr()
+	encoding, batched := strings.CutSuffix(conn.Subprotocol(), wsBatchSuffix)
+	if encoding == "" {
+		encoding = h.defaultEncoding
+	}
+	batchInterval := h.batchInterval
+	if batched && batchInterval == 0 {
+		batchInterval = wsDefaultBatchInterval
+	}
 
-	ch := make(chan *wsUpdateMessage)
-	h.clientsLock.Lock()
-	h.clients = append(h.clients, ch)
-	slog.Info("New WebSocket connection", "addr", remoteAddr, "current", len(h.clients))
-	h.clientsLock.Unlock()
+	ch, count, unsubscribe := h.hub.Subscribe(r.Context(), 0)
+	slog.Info("New WebSocket connection", "addr", remoteAddr, "current", count)
 	defer func() {
-		h.clientsLock.Lock()
-		h.clients = lo.Without(h.clients, ch)
-		slog.Info("Closing WebSocket connection", "addr", remoteAddr, "current", len(h.clients))
-		h.clientsLock.Unlock()
+		count := unsubscribe()
+		slog.Info("Closing WebSocket connection", "addr", remoteAddr, "current", count)
 	}()
 
 	ctx, cancel := context.WithCancel(r.Context())
 	go func() {
 		defer cancel()
 		for {
-			_, _, err := conn.ReadMessage()
+			msgType, rawMsg, err := conn.ReadMessage()
 			if errors.Is(err, io.EOF) {
 				return
 			}
@@ -125,141 +236,377 @@ func (h *httpServerExporter) connectWS(w http.ResponseWriter, r *http.Request) {
 				slog.Error("Reading message", "err", err)
 				return
 			}
+			if h.handleInput(msgType, rawMsg) {
+				continue
+			}
+			if msgType == websocket.TextMessage {
+				h.handleControl(rawMsg)
+			}
 		}
 	}()
 
 	// Send first data (if any)
-	data := h.data // copy
+	data := h.hub.Latest()
 	if !data.Time.IsZero() {
 		msg := wsUpdateMessage{Data: data, UpdatedKey: "all"}
-		if err = conn.WriteJSON(&msg); err != nil {
+		if batchInterval > 0 {
+			err = writeWSMessage(conn, encoding, []*wsUpdateMessage{&msg})
+		} else {
+			err = writeWSMessage(conn, encoding, &msg)
+		}
+		if err != nil {
 			slog.Error("Writing message", "err", err)
 			return
 		}
 	}
 
-	// Send real-time data
+	// Send real-time data, and periodic snapshots
+	snapshots := h.snapshots(ctx)
+	if batchInterval > 0 {
+		sendBatches(ctx, conn, encoding, batchInterval, ch, snapshots)
+		return
+	}
+	for {
+		var msg *wsUpdateMessage
+		select {
+		case <-ctx.Done():
+			return
+		case msg = <-ch:
+		case msg = <-snapshots:
+		}
+		if err = writeWSMessage(conn, encoding, msg); err != nil {
+			slog.Error("Writing message", "err", err)
+			return
+		}
+	}
+}
+
+// snapshots returns a channel of "all" update messages with the latest data, one every
+// snapshotInterval until ctx is done, or nil if disabled. Nothing is sent before the first data.
+func (h *httpServerExporter) snapshots(ctx context.Context) <-chan *wsUpdateMessage {
+	if h.snapshotInterval == 0 {
+		return nil
+	}
+	ch := make(chan *wsUpdateMessage)
+	go func() {
+		ticker := time.NewTicker(h.snapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			data := h.hub.Latest()
+			if data.Time.IsZero() {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- &wsUpdateMessage{Data: data, UpdatedKey: "all"}:
+			}
+		}
+	}()
+	return ch
+}
+
+// sendBatches sends the messages from ch and snapshots as arrays, each collected for up to
+// interval after its first message, until ctx is done.
+func sendBatches(ctx context.Context, conn *websocket.Conn, encoding string, interval time.Duration, ch, snapshots <-chan *wsUpdateMessage) {
+	var batch []*wsUpdateMessage
+	var flush <-chan time.Time
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case msg := <-ch:
-			if err = conn.WriteJSON(msg); err != nil {
+			batch = append(batch, msg)
+		case msg := <-snapshots:
+			batch = append(batch, msg)
+		case <-flush:
+			if err := writeWSMessage(conn, encoding, batch); err != nil {
 				slog.Error("Writing message", "err", err)
 				return
 			}
+			batch, flush = nil, nil
+			continue
+		}
+		if flush == nil {
+			flush = time.After(interval)
 		}
 	}
 }
 
-type oscExporter struct {
-	client       *osc.Client
-	heartRateMax float64
-	addrName     string
+// streamEvents streams update messages as Server-Sent Events.
+func (h *httpServerExporter) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	remoteAddr := r.RemoteAddr
+	ch, count, unsubscribe := h.hub.Subscribe(r.Context(), 0)
+	slog.Info("New SSE connection", "addr", remoteAddr, "current", count)
+	defer func() {
+		count := unsubscribe()
+		slog.Info("Closing SSE connection", "addr", remoteAddr, "current", count)
+	}()
 
-	enableAddrName string
-	disableLater   func()
+	// Send first data (if any)
+	data := h.hub.Latest()
+	if !data.Time.IsZero() {
+		msg := wsUpdateMessage{Data: data, UpdatedKey: "all"}
+		if err := writeSSEMessage(w, &msg); err != nil {
+			slog.Error("Writing event", "err", err)
+			return
+		}
+		flusher.Flush()
+	}
+
+	// Send real-time data
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-ch:
+			if err := writeSSEMessage(w, msg); err != nil {
+				slog.Error("Writing event", "err", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
 }
 
-func newOSCExporter(sendIP string, sendPort int, addrName, enableAddrName string, enableDebounce time.Duration) *oscExporter {
-	slog.Info("OSC config", "addr", addrName, "ip", sendIP+":"+strconv.Itoa(sendPort))
-	client := osc.NewClient(sendIP, sendPort)
+// writeSSEMessage sends msg as a single-line JSON "data:" event.
+func writeSSEMessage(w io.Writer, msg *wsUpdateMessage) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", b)
+	return err
+}
 
-	o := &oscExporter{
-		client:         client,
-		heartRateMax:   256.0,
-		addrName:       addrName,
-		enableAddrName: enableAddrName,
+// wsControlMessage is sent by WebSocket clients to change settings at runtime. It is only
+// accepted with -ws-server-token, as it can redirect the OSC messages to any host.
+type wsControlMessage struct {
+	// OSCProfile switches the active OSC profile
+	OSCProfile string `json:"oscProfile,omitempty"`
+	// OSCPort switches the OSC destination port, and OSCIP its address if set
+	OSCPort int    `json:"oscPort,omitempty"`
+	OSCIP   string `json:"oscIp,omitempty"`
+}
+
+// setOnControl starts accepting control messages, handled by f.
+func (h *httpServerExporter) setOnControl(f func(msg wsControlMessage) error) {
+	h.onControlLock.Lock()
+	defer h.onControlLock.Unlock()
+	h.onControl = f
+}
+
+// handleControl handles a control message, ignoring it while no handler is set.
+func (h *httpServerExporter) handleControl(rawMsg []byte) {
+	h.onControlLock.RLock()
+	onControl := h.onControl
+	h.onControlLock.RUnlock()
+	if onControl == nil {
+		return
 	}
-	disable := func() {
-		err := o.sendEnabled(false)
-		if err != nil {
-			slog.Error("Sending OSC message", "err", err)
-		}
+
+	var msg wsControlMessage
+	if err := json.Unmarshal(rawMsg, &msg); err != nil {
+		slog.Warn("Decoding control message", "err", err)
+		return
 	}
-	debounced := debounce.New(enableDebounce)
-	o.disableLater = func() {
-		debounced(disable)
+	if err := onControl(msg); err != nil {
+		slog.Warn("Handling control message", "err", err)
 	}
-	return o
 }
 
-func (o *oscExporter) sendEnabled(enabled bool) error {
-	msg := osc.NewMessage(o.enableAddrName)
-	msg.Append(enabled)
-	slog.Debug("Sending OSC message", "msg", msg)
-	return o.client.Send(msg)
+// setInput starts accepting data pushed by clients, sent to input.
+func (h *httpServerExporter) setInput(input []exporter) {
+	h.inputLock.Lock()
+	defer h.inputLock.Unlock()
+	h.input = input
 }
 
-func (o *oscExporter) Update(data healthData, updatedKey string) error {
-	if updatedKey != "heartRate" && updatedKey != "all" {
-		return nil
+// handleInput feeds data pushed by a client into the input exporters, and reports whether
+// rawMsg was data: a wsUpdateMessage in either encoding, or a "key:value" text as sent by HDS.
+// It reports false for all messages while no input is set.
+func (h *httpServerExporter) handleInput(msgType int, rawMsg []byte) bool {
+	h.inputLock.Lock()
+	defer h.inputLock.Unlock()
+	if h.input == nil {
+		return false
 	}
 
-	err := o.sendEnabled(true)
-	if err != nil {
-		return err
+	var msg wsUpdateMessage
+	switch {
+	case msgType == websocket.BinaryMessage:
+		if err := unmarshalMsgpack(rawMsg, &msg); err != nil {
+			slog.Warn("Decoding pushed message", "err", err)
+			return true
+		}
+		h.inputData = msg.Data
+	case bytes.HasPrefix(bytes.TrimSpace(rawMsg), []byte("{")):
+		// Control messages are JSON objects too, but have no updatedKey
+		if err := json.Unmarshal(rawMsg, &msg); err != nil || msg.UpdatedKey == "" {
+			return false
+		}
+		h.inputData = msg.Data
+	default:
+		key, value, err := parseKeyValue(string(rawMsg))
+		if err != nil {
+			slog.Warn("Parsing pushed data", "data", string(rawMsg), "err", err)
+			return true
+		}
+		h.inputData.Update(key, value)
+		msg = wsUpdateMessage{Data: h.inputData, UpdatedKey: key}
 	}
-	o.disableLater()
 
-	msg := osc.NewMessage(o.addrName)
-	floatRate := float64(data.HeartRate) / o.heartRateMax
-	msg.Append(float32(floatRate))
-	slog.Debug("Sending OSC message", "msg", msg)
-	return o.client.Send(msg)
+	slog.Info("Received pushed msg", "updatedKey", msg.UpdatedKey, "data", msg.Data)
+	receivedUpdates.Inc("ws-server")
+	sendToExporters(h.input, msg.Data, msg.UpdatedKey)
+	return true
+}
+
+// wsWriteTimeout is how long a WebSocket write may block on a client not reading, before
+// the client is disconnected. Its unsubscribe then removes it from the broadcaster.
+// A variable so that tests can shorten it.
+var wsWriteTimeout = 10 * time.Second
+
+// writeWSMessage sends msg, a message or a batch of them, as a text JSON frame, or a binary MessagePack frame.
+// A write not completing within wsWriteTimeout fails, and the connection must be closed.
+func writeWSMessage(conn *websocket.Conn, encoding string, msg any) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	if encoding == wsEncodingMsgpack {
+		b, err := marshalMsgpack(msg)
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(websocket.BinaryMessage, b)
+	}
+	return conn.WriteJSON(msg)
 }
 
 type prometheusExporter struct {
 	registry *prometheus.Registry
+	// ungatedRegistry holds the pipeline counters, and the Go runtime and process collectors if enabled.
+	// It is served even while data is stale, when the counters are needed to diagnose the stall.
+	ungatedRegistry *prometheus.Registry
+
+	// stalenessKey is the field whose freshness gates the health metrics, or "any" or "all"
+	stalenessKey string
 
-	data     healthData
-	dataLock sync.RWMutex
+	data        healthData
+	calorieRate rateTracker
+	// Counter totals, kept increasing across source resets
+	stepTotal     monotonicCounter
+	distanceTotal monotonicCounter
+	calorieTotal  monotonicCounter
+	dataLock      sync.RWMutex
 
 	heartRate        prometheus.GaugeFunc
 	stepCount        prometheus.CounterFunc
 	distanceTraveled prometheus.CounterFunc
 	speed            prometheus.GaugeFunc
 	calories         prometheus.CounterFunc
+	calorieRateGauge prometheus.GaugeFunc
+	speedKmh         prometheus.GaugeFunc
+	speedMph         prometheus.GaugeFunc
+	sessionDuration  prometheus.GaugeFunc
+	hrvEstimate      prometheus.GaugeFunc
+}
+
+func newPrometheusExporter(port int, namespace string, goMetrics bool, stalenessKey, authUser, authPass, tlsCert, tlsKey string) *prometheusExporter {
+	e := newPrometheusMetrics(namespace, goMetrics, stalenessKey)
+	registerReset("prom", e.resetCounters)
+
+	// Start HTTP server for metrics
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", basicAuth(authUser, authPass, e))
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		slog.Error("Starting prometheus metrics server", "err", err)
+		os.Exit(1)
+	}
+	if tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			slog.Error("Loading prometheus TLS certificate", "err", err)
+			os.Exit(1)
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+	go func() {
+		slog.Info("Prometheus metrics server listening...", "port", port, "tls", tlsCert != "")
+		if err := http.Serve(listener, mux); err != nil {
+			slog.Error("Starting prometheus metrics server", "err", err)
+			os.Exit(1)
+		}
+	}()
+
+	return e
 }
 
-func newPrometheusExporter(port int) *prometheusExporter {
-	e := &prometheusExporter{}
+// newPrometheusMetrics creates the metrics registry, without serving it.
+// goMetrics additionally registers the Go runtime and process collectors.
+func newPrometheusMetrics(namespace string, goMetrics bool, stalenessKey string) *prometheusExporter {
+	e := &prometheusExporter{stalenessKey: stalenessKey}
 	// Create a custom registry without default collectors
 	e.registry = prometheus.NewRegistry()
+	e.ungatedRegistry = prometheus.NewRegistry()
+	registerPipelineCollectors(e.ungatedRegistry, namespace)
+	if goMetrics {
+		e.ungatedRegistry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	}
 
 	e.heartRate = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
-		Name: "heart_rate",
-		Help: "Current heart rate in beats per minute",
+		Namespace: namespace,
+		Name:      "heart_rate",
+		Help:      "Current heart rate in beats per minute",
 	}, func() float64 {
 		e.dataLock.RLock()
 		defer e.dataLock.RUnlock()
-		return float64(e.data.HeartRate)
+		return e.data.HeartRateValue()
 	})
 	e.registry.MustRegister(e.heartRate)
 
 	e.stepCount = prometheus.NewCounterFunc(prometheus.CounterOpts{
-		Name: "step_count",
-		Help: "Current step count",
+		Namespace: namespace,
+		Name:      "step_count",
+		Help:      "Total step count, accumulated across source resets",
 	}, func() float64 {
 		e.dataLock.RLock()
 		defer e.dataLock.RUnlock()
-		return float64(e.data.StepCount)
+		return e.stepTotal.Total()
 	})
 	e.registry.MustRegister(e.stepCount)
 
 	e.distanceTraveled = prometheus.NewCounterFunc(prometheus.CounterOpts{
-		Name: "distance_traveled",
-		Help: "Current distance traveled in meters",
+		Namespace: namespace,
+		Name:      "distance_traveled",
+		Help:      "Total distance traveled in meters, accumulated across source resets",
 	}, func() float64 {
 		e.dataLock.RLock()
 		defer e.dataLock.RUnlock()
-		return e.data.DistanceTraveled
+		return e.distanceTotal.Total()
 	})
 	e.registry.MustRegister(e.distanceTraveled)
 
 	e.speed = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
-		Name: "speed",
-		Help: "Current speed in meters per second",
+		Namespace: namespace,
+		Name:      "speed",
+		Help:      "Current speed in meters per second",
 	}, func() float64 {
 		e.dataLock.RLock()
 		defer e.dataLock.RUnlock()
@@ -267,51 +614,140 @@ func newPrometheusExporter(port int) *prometheusExporter {
 	})
 	e.registry.MustRegister(e.speed)
 
+	e.speedKmh = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "speed_kmh",
+		Help:      "Current speed in kilometers per hour",
+	}, func() float64 {
+		e.dataLock.RLock()
+		defer e.dataLock.RUnlock()
+		return e.data.SpeedKmh()
+	})
+	e.registry.MustRegister(e.speedKmh)
+
+	if imperialUnits {
+		e.speedMph = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "speed_mph",
+			Help:      "Current speed in miles per hour",
+		}, func() float64 {
+			e.dataLock.RLock()
+			defer e.dataLock.RUnlock()
+			return e.data.SpeedMph()
+		})
+		e.registry.MustRegister(e.speedMph)
+	}
+
 	e.calories = prometheus.NewCounterFunc(prometheus.CounterOpts{
-		Name: "calories",
-		Help: "Current calories burned",
+		Namespace: namespace,
+		Name:      "calories",
+		Help:      "Total calories burned, accumulated across source resets",
 	}, func() float64 {
 		e.dataLock.RLock()
 		defer e.dataLock.RUnlock()
-		return float64(e.data.Calories)
+		return e.calorieTotal.Total()
 	})
 	e.registry.MustRegister(e.calories)
 
-	// Start HTTP server for metrics
-	go func() {
-		mux := http.NewServeMux()
-		mux.Handle("/metrics", e)
+	e.calorieRateGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "calorie_rate",
+		Help:      "Current calorie burn rate in kcal per minute",
+	}, func() float64 {
+		e.dataLock.RLock()
+		defer e.dataLock.RUnlock()
+		return e.calorieRate.Rate()
+	})
+	e.registry.MustRegister(e.calorieRateGauge)
 
-		slog.Info("Prometheus metrics server listening...", "port", port)
-		if err := http.ListenAndServe(":"+strconv.Itoa(port), mux); err != nil {
-			slog.Error("Starting prometheus metrics server", "err", err)
-			os.Exit(1)
-		}
-	}()
+	e.sessionDuration = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "session_duration_seconds",
+		Help:      "Elapsed time of the current session in seconds",
+	}, func() float64 {
+		e.dataLock.RLock()
+		defer e.dataLock.RUnlock()
+		return e.data.SessionDuration().Seconds()
+	})
+	e.registry.MustRegister(e.sessionDuration)
+
+	e.hrvEstimate = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "hrv_estimate",
+		Help:      "Approximate heart rate variability in milliseconds, from the timing between heart rate updates",
+	}, func() float64 {
+		e.dataLock.RLock()
+		defer e.dataLock.RUnlock()
+		return e.data.HRVEstimate
+	})
+	e.registry.MustRegister(e.hrvEstimate)
 
 	return e
 }
 
-func (p *prometheusExporter) Update(data healthData, _ string) error {
+func (p *prometheusExporter) Update(data healthData, updatedKey string) error {
 	p.dataLock.Lock()
 	p.data = data
+	p.stepTotal.Update(float64(data.StepCount))
+	p.distanceTotal.Update(data.DistanceTraveled)
+	p.calorieTotal.Update(float64(data.Calories))
+	if updatedKey == "calories" || updatedKey == "all" {
+		p.calorieRate.Update(float64(data.Calories), data.Time)
+	}
 	p.dataLock.Unlock()
 	return nil
 }
 
-// ServeHTTP implements http.Handler to serve metrics only when data is fresh
-func (p *prometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p.dataLock.RLock()
-	lastReceived := p.data.Time
-	p.dataLock.RUnlock()
+// resetCounters resets the counter bases if counters is set, returning the totals before.
+func (p *prometheusExporter) resetCounters(counters bool) any {
+	if !counters {
+		return nil
+	}
+	p.dataLock.Lock()
+	defer p.dataLock.Unlock()
+	return resetCounterBases(&p.stepTotal, &p.distanceTotal, &p.calorieTotal)
+}
 
-	// If no data received yet or data is stale (older than 30 seconds), return empty response
-	if lastReceived.IsZero() || time.Since(lastReceived) > 30*time.Second {
-		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		return
+// validateStalenessKey checks a -prom-staleness-key value.
+func validateStalenessKey(key string) error {
+	if key != "any" && key != "all" && !slices.Contains(healthDataKeys, key) {
+		return fmt.Errorf("invalid staleness key %q, must be any, all or one of %v", key, healthDataKeys)
 	}
+	return nil
+}
 
-	// Otherwise, serve metrics from our custom registry
-	promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+// stale reports whether the data is stale, judged by stalenessKey: "any" is fresh while any field
+// updates, "all" only while every field updated so far does, otherwise the named field must be fresh.
+func (p *prometheusExporter) stale() bool {
+	p.dataLock.RLock()
+	defer p.dataLock.RUnlock()
+	switch p.stalenessKey {
+	case "any":
+		return isStale(p.data.Time)
+	case "all":
+		if p.data.Time.IsZero() {
+			return true
+		}
+		return slices.ContainsFunc(healthDataKeys, func(key string) bool {
+			t := p.data.KeyTimes.Get(key)
+			return !t.IsZero() && isStale(t)
+		})
+	default:
+		return isStale(p.data.KeyTimes.Get(p.stalenessKey))
+	}
+}
+
+// ServeHTTP implements http.Handler to serve the health metrics only when data is fresh
+func (p *prometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(p.gatherers(), promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// gatherers returns the registries to report: the health metrics only while data is fresh,
+// together with the ungated metrics.
+func (p *prometheusExporter) gatherers() prometheus.Gatherers {
+	gatherers := prometheus.Gatherers{p.ungatedRegistry}
+	if !p.stale() {
+		gatherers = append(gatherers, p.registry)
+	}
+	return gatherers
 }
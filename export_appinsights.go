@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// appInsightsMaxAttempts is how many times a push is attempted, retrying throttling and transient errors.
+	appInsightsMaxAttempts = 5
+	appInsightsFirstWait   = time.Second
+)
+
+// appInsightsExporter periodically sends the latest data to Application Insights as custom metrics,
+// through the ingestion endpoint authenticated with the instrumentation key.
+type appInsightsExporter struct {
+	client   *http.Client
+	endpoint string
+	iKey     string
+
+	data     healthData
+	dataLock sync.RWMutex
+
+	// Pushes happen on their own interval, so health is tracked there rather than from Update
+	healthTracker
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "azure",
+		description: "Azure Monitor Application Insights custom metrics, sent to the ingestion endpoint with an instrumentation key",
+		flags:       []string{"azure-ikey", "azure-endpoint", "azure-interval"},
+		enabled:     func(cfg exporterConfig) bool { return cfg.String("ikey") != "" },
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			interval, err := cfg.Duration("interval")
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("Application Insights enabled", "endpoint", cfg.String("endpoint"), "interval", interval)
+			return newAppInsightsExporter(env.ctx, cfg.String("endpoint"), cfg.String("ikey"), interval), nil
+		},
+	})
+}
+
+func newAppInsightsExporter(ctx context.Context, endpoint, iKey string, interval time.Duration) *appInsightsExporter {
+	a := &appInsightsExporter{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: endpoint,
+		iKey:     iKey,
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := a.push(ctx)
+				if err != nil {
+					slog.Error("Pushing Application Insights metrics", "err", err)
+				}
+				a.record(err)
+			}
+		}
+	}()
+	return a
+}
+
+func (a *appInsightsExporter) Update(data healthData, _ string) error {
+	a.dataLock.Lock()
+	a.data = data
+	a.dataLock.Unlock()
+	return nil
+}
+
+// appInsightsEnvelope is a telemetry item of the ingestion API, here always a metric.
+type appInsightsEnvelope struct {
+	Name string          `json:"name"`
+	Time string          `json:"time"`
+	IKey string          `json:"iKey"`
+	Data appInsightsData `json:"data"`
+}
+
+type appInsightsData struct {
+	BaseType string                `json:"baseType"`
+	BaseData appInsightsMetricData `json:"baseData"`
+}
+
+type appInsightsMetricData struct {
+	Ver     int                    `json:"ver"`
+	Metrics []appInsightsDataPoint `json:"metrics"`
+}
+
+type appInsightsDataPoint struct {
+	Name  string  `json:"name"`
+	Kind  int     `json:"kind"` // 0 for a single measurement
+	Value float64 `json:"value"`
+	Count int     `json:"count"`
+}
+
+// push sends one metric item per field in one batch, or nothing while data is absent or stale.
+func (a *appInsightsExporter) push(ctx context.Context) error {
+	a.dataLock.RLock()
+	data := a.data
+	a.dataLock.RUnlock()
+	if isStale(data.Time) {
+		return nil
+	}
+
+	metrics := map[string]float64{
+		"HeartRate":        data.HeartRateValue(),
+		"StepCount":        float64(data.StepCount),
+		"DistanceTraveled": data.DistanceTraveled,
+		"Speed":            data.Speed,
+		"Calories":         float64(data.Calories),
+	}
+	envelopes := make([]appInsightsEnvelope, 0, len(metrics))
+	for name, value := range metrics {
+		envelopes = append(envelopes, appInsightsEnvelope{
+			Name: "Microsoft.ApplicationInsights.Metric",
+			Time: data.Time.UTC().Format(time.RFC3339Nano),
+			IKey: a.iKey,
+			Data: appInsightsData{
+				BaseType: "MetricData",
+				BaseData: appInsightsMetricData{
+					Ver:     2,
+					Metrics: []appInsightsDataPoint{{Name: name, Value: value, Count: 1}},
+				},
+			},
+		})
+	}
+	body, err := json.Marshal(envelopes)
+	if err != nil {
+		return fmt.Errorf("encoding metrics: %v", err)
+	}
+
+	wait := appInsightsFirstWait
+	for attempt := 1; ; attempt++ {
+		retry, err := a.send(ctx, body)
+		if err == nil || !retry || attempt == appInsightsMaxAttempts {
+			return err
+		}
+		slog.Warn("Retrying Application Insights push", "err", err, "attempt", attempt, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// send posts the batch once. retry reports whether a failure is transient: network errors,
+// throttling and server errors. Rejected keys and payloads are not retried, nor partially
+// accepted batches, which would duplicate the accepted items.
+func (a *appInsightsExporter) send(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("posting metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("ingestion returned %s: %s", resp.Status, respBody)
+	retry = resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
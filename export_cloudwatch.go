@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// cloudWatchMaxAttempts is how many times a push is attempted, retrying throttling and transient errors.
+const cloudWatchMaxAttempts = 5
+
+// cloudWatchExporter periodically pushes the latest data to CloudWatch as custom metrics.
+type cloudWatchExporter struct {
+	client     *cloudwatch.Client
+	namespace  string
+	dimensions []types.Dimension
+
+	data     healthData
+	dataLock sync.RWMutex
+
+	// Pushes happen on their own interval, so health is tracked there rather than from Update
+	healthTracker
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "cloudwatch",
+		description: "CloudWatch custom metrics pushed with PutMetricData, using the default AWS credential chain",
+		flags:       []string{"cloudwatch-enabled", "cloudwatch-namespace", "cloudwatch-dimensions", "cloudwatch-region", "cloudwatch-interval"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			interval, err := cfg.Duration("interval")
+			if err != nil {
+				return nil, err
+			}
+			dimensions, err := parseCloudWatchDimensions(cfg.String("dimensions"))
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("CloudWatch enabled", "namespace", cfg.String("namespace"), "interval", interval)
+			return newCloudWatchExporter(env.ctx, cfg.String("namespace"), dimensions, cfg.String("region"), interval)
+		},
+	})
+}
+
+// parseCloudWatchDimensions parses "Name=Value,Name2=Value2" style dimensions.
+func parseCloudWatchDimensions(s string) ([]types.Dimension, error) {
+	var dimensions []types.Dimension
+	if s == "" {
+		return dimensions, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("invalid CloudWatch dimension %q, expected Name=Value", pair)
+		}
+		dimensions = append(dimensions, types.Dimension{Name: aws.String(name), Value: aws.String(value)})
+	}
+	return dimensions, nil
+}
+
+// newCloudWatchExporter creates the client from the default credential chain, with region
+// overriding the configured one if set, and pushes every interval until ctx is cancelled.
+func newCloudWatchExporter(ctx context.Context, namespace string, dimensions []types.Dimension, region string, interval time.Duration) (*cloudWatchExporter, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRetryer(func() aws.Retryer {
+			return retry.AddWithMaxAttempts(retry.NewStandard(), cloudWatchMaxAttempts)
+		}),
+	}
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %v", err)
+	}
+
+	c := &cloudWatchExporter{
+		client:     cloudwatch.NewFromConfig(awsCfg),
+		namespace:  namespace,
+		dimensions: dimensions,
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := c.push(ctx)
+				if err != nil {
+					slog.Error("Pushing CloudWatch metrics", "err", err)
+				}
+				c.record(err)
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (c *cloudWatchExporter) Update(data healthData, _ string) error {
+	c.dataLock.Lock()
+	c.data = data
+	c.dataLock.Unlock()
+	return nil
+}
+
+// push sends the five metrics in one PutMetricData call, or nothing while data is absent or stale.
+func (c *cloudWatchExporter) push(ctx context.Context) error {
+	c.dataLock.RLock()
+	data := c.data
+	c.dataLock.RUnlock()
+	if isStale(data.Time) {
+		return nil
+	}
+
+	datum := func(name string, value float64, unit types.StandardUnit) types.MetricDatum {
+		return types.MetricDatum{
+			MetricName: aws.String(name),
+			Value:      aws.Float64(value),
+			Unit:       unit,
+			Timestamp:  aws.Time(data.Time),
+			Dimensions: c.dimensions,
+		}
+	}
+	_, err := c.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace: aws.String(c.namespace),
+		MetricData: []types.MetricDatum{
+			datum("HeartRate", data.HeartRateValue(), types.StandardUnitNone),
+			datum("StepCount", float64(data.StepCount), types.StandardUnitCount),
+			datum("DistanceTraveled", data.DistanceTraveled, types.StandardUnitNone),
+			datum("Speed", data.Speed, types.StandardUnitNone),
+			datum("Calories", float64(data.Calories), types.StandardUnitCount),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("putting metric data: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// graphiteBufferLines is how many lines are kept while the server is unreachable, dropping the oldest
+	graphiteBufferLines = 1000
+	graphiteFirstWait   = time.Second
+	graphiteMaxBackoff  = 30 * time.Second
+	graphiteDialTimeout = 5 * time.Second
+)
+
+// graphiteMetricNames are the metric path suffixes of the fields, as in the Prometheus exporter.
+var graphiteMetricNames = map[string]string{
+	"heartRate":        "heart_rate",
+	"stepCount":        "step_count",
+	"distanceTraveled": "distance_traveled",
+	"speed":            "speed",
+	"calories":         "calories",
+}
+
+// graphiteExporter sends the updated fields as plaintext protocol lines over TCP to Carbon.
+// Lines are written from its own goroutine, buffered while reconnecting after a failure.
+type graphiteExporter struct {
+	addr   string
+	prefix string
+
+	conn    net.Conn
+	pending []string
+	lock    sync.Mutex
+	wake    chan struct{}
+
+	// Writes happen in sendLoop, so health is tracked there rather than from Update
+	healthTracker
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "graphite",
+		description: "Graphite plaintext protocol lines over TCP, e.g. to Carbon",
+		flags:       []string{"graphite-enabled", "graphite-addr", "graphite-prefix"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("Graphite enabled", "addr", cfg.String("addr"), "prefix", cfg.String("prefix"))
+			return newGraphiteExporter(env.ctx, env.shutdown, cfg.String("addr"), cfg.String("prefix")), nil
+		},
+	})
+}
+
+// newGraphiteExporter creates an exporter sending until ctx is cancelled, when the buffered
+// lines are attempted once more before shutdown completes.
+func newGraphiteExporter(ctx context.Context, shutdown *sync.WaitGroup, addr, prefix string) *graphiteExporter {
+	g := &graphiteExporter{
+		addr:   addr,
+		prefix: strings.TrimSuffix(prefix, "."),
+		wake:   make(chan struct{}, 1),
+	}
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		g.sendLoop(ctx)
+	}()
+	return g
+}
+
+// lines formats the fields updated by updatedKey, timestamped with the data time.
+func (g *graphiteExporter) lines(data healthData, updatedKey string) []string {
+	keys := []string{updatedKey}
+	if updatedKey == "all" {
+		keys = healthDataKeys
+	}
+	ts := strconv.FormatInt(data.Time.Unix(), 10)
+	var lines []string
+	for _, key := range keys {
+		value, ok := data.Get(key)
+		if !ok || (updatedKey == "all" && data.KeyTimes.Get(key).IsZero()) {
+			continue
+		}
+		lines = append(lines, g.prefix+"."+graphiteMetricNames[key]+" "+strconv.FormatFloat(value, 'f', -1, 64)+" "+ts+"\n")
+	}
+	return lines
+}
+
+func (g *graphiteExporter) Update(data healthData, updatedKey string) error {
+	lines := g.lines(data, updatedKey)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	g.lock.Lock()
+	g.pending = append(g.pending, lines...)
+	g.trimPending()
+	g.lock.Unlock()
+
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// trimPending drops the oldest pending lines beyond graphiteBufferLines. Called with lock held.
+func (g *graphiteExporter) trimPending() {
+	if over := len(g.pending) - graphiteBufferLines; over > 0 {
+		g.pending = g.pending[over:]
+		for range over {
+			countDropped(dropStageExporter)
+		}
+	}
+}
+
+// sendLoop writes the pending lines, backing off between failed attempts, until ctx is cancelled.
+func (g *graphiteExporter) sendLoop(ctx context.Context) {
+	r := newReconnector(graphiteFirstWait, graphiteMaxBackoff)
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			if err := g.flush(); err != nil {
+				slog.Error("Sending remaining Graphite lines", "err", err)
+			}
+			g.lock.Lock()
+			if g.conn != nil {
+				_ = g.conn.Close()
+			}
+			g.lock.Unlock()
+			return
+		case <-g.wake:
+			if retry != nil {
+				// Still backing off, the lines stay buffered
+				continue
+			}
+		case <-retry:
+		}
+
+		err := g.flush()
+		g.record(err)
+		if err != nil {
+			wait := r.next(err)
+			slog.Error("Sending Graphite lines", "err", err, "retryIn", wait)
+			retry = time.After(wait)
+			continue
+		}
+		r.next(nil)
+		retry = nil
+	}
+}
+
+// flush writes the pending lines, dialing first if not connected. On failure, the lines are
+// kept for the next attempt, and the connection dropped so that it is redialed.
+func (g *graphiteExporter) flush() error {
+	g.lock.Lock()
+	lines := g.pending
+	g.pending = nil
+	conn := g.conn
+	g.lock.Unlock()
+	if len(lines) == 0 {
+		return nil
+	}
+
+	err := func() error {
+		if conn == nil {
+			var err error
+			conn, err = net.DialTimeout("tcp", g.addr, graphiteDialTimeout)
+			if err != nil {
+				return fmt.Errorf("dialing Graphite server: %v", err)
+			}
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(graphiteDialTimeout))
+		if _, err := conn.Write([]byte(strings.Join(lines, ""))); err != nil {
+			_ = conn.Close()
+			conn = nil
+			return fmt.Errorf("writing Graphite lines: %v", err)
+		}
+		return nil
+	}()
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.conn = conn
+	if err != nil {
+		// Put the lines back before those queued meanwhile, keeping the newest within the buffer
+		g.pending = append(lines, g.pending...)
+		g.trimPending()
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/motoki317/hds-osc/hdspb"
+)
+
+// grpcServer serves data received by hub over the gRPC HealthService.
+type grpcServer struct {
+	hdspb.UnimplementedHealthServiceServer
+	hub *broadcaster
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "grpc",
+		description: "gRPC server streaming update messages",
+		flags:       []string{"grpc-port"},
+		enabled:     func(cfg exporterConfig) bool { return cfg.Int("port") != 0 },
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("gRPC server enabled", "port", cfg.Int("port"))
+			return nil, startGRPCServer(env.ctx, env.shutdown, env.broadcaster(), cfg.Int("port"))
+		},
+	})
+}
+
+func startGRPCServer(ctx context.Context, shutdown *sync.WaitGroup, hub *broadcaster, port int) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return fmt.Errorf("listening gRPC port: %v", err)
+	}
+
+	server := grpc.NewServer()
+	hdspb.RegisterHealthServiceServer(server, &grpcServer{hub: hub})
+
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		<-ctx.Done()
+		// Subscribe streams never end by themselves, so don't wait for them
+		server.Stop()
+		slog.Info("gRPC server stopped")
+	}()
+	go func() {
+		slog.Info("gRPC server listening...", "port", port)
+		if err := server.Serve(listener); err != nil {
+			slog.Error("Serving gRPC", "err", err)
+		}
+	}()
+	return nil
+}
+
+func healthDataToProto(d healthData) *hdspb.HealthData {
+	return &hdspb.HealthData{
+		Time:             timestamppb.New(d.Time),
+		HeartRate:        int32(d.HeartRate),
+		StepCount:        int32(d.StepCount),
+		DistanceTraveled: d.DistanceTraveled,
+		Speed:            d.Speed,
+		Calories:         int32(d.Calories),
+	}
+}
+
+func (g *grpcServer) GetLatest(context.Context, *hdspb.GetLatestRequest) (*hdspb.HealthData, error) {
+	data := g.hub.Latest()
+	if data.Time.IsZero() {
+		return nil, status.Error(codes.NotFound, "no data received yet")
+	}
+	return healthDataToProto(data), nil
+}
+
+func (g *grpcServer) Subscribe(_ *hdspb.SubscribeRequest, stream grpc.ServerStreamingServer[hdspb.UpdateMessage]) error {
+	ch, count, unsubscribe := g.hub.Subscribe(stream.Context(), 16)
+	slog.Info("New gRPC subscriber", "current", count)
+	defer func() {
+		count := unsubscribe()
+		slog.Info("Closing gRPC subscriber", "current", count)
+	}()
+
+	// Send first data (if any)
+	if data := g.hub.Latest(); !data.Time.IsZero() {
+		if err := stream.Send(&hdspb.UpdateMessage{Data: healthDataToProto(data), UpdatedKey: "all"}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case msg := <-ch:
+			if err := stream.Send(&hdspb.UpdateMessage{Data: healthDataToProto(msg.Data), UpdatedKey: msg.UpdatedKey}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaExporter produces update messages asynchronously, so that a slow broker does not hold up
+// the pipeline. Delivery results arrive in batches later, so health is tracked from those.
+type kafkaExporter struct {
+	// ctx is done once the writer is closing, after which updates are ignored
+	ctx    context.Context
+	writer *kafka.Writer
+	healthTracker
+}
+
+// kafkaBatchTimeout is how long messages are collected before a batch is written.
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "kafka",
+		description: "Kafka producer of update messages",
+		flags:       []string{"kafka-enabled", "kafka-brokers", "kafka-produce-topic"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("Kafka enabled", "brokers", cfg.String("brokers"), "topic", cfg.String("produce-topic"))
+			return newKafkaExporter(env.ctx, env.shutdown, strings.Split(cfg.String("brokers"), ","), cfg.String("produce-topic")), nil
+		},
+	})
+}
+
+// newKafkaExporter creates an exporter producing until ctx is cancelled, when the pending
+// messages are flushed before shutdown completes.
+func newKafkaExporter(ctx context.Context, shutdown *sync.WaitGroup, brokers []string, topic string) *kafkaExporter {
+	slog.Info("Kafka exporter configured", "brokers", brokers, "topic", topic)
+	k := &kafkaExporter{ctx: ctx}
+	k.writer = &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireOne,
+		Async:        true,
+		BatchTimeout: kafkaBatchTimeout,
+		Completion:   k.completed,
+	}
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		<-ctx.Done()
+		if err := k.writer.Close(); err != nil {
+			slog.Error("Closing kafka writer", "err", err)
+		}
+	}()
+	return k
+}
+
+// completed records the delivery result of a batch of messages.
+func (k *kafkaExporter) completed(messages []kafka.Message, err error) {
+	if err != nil {
+		err = fmt.Errorf("writing kafka messages: %v", err)
+		slog.Error("Kafka delivery", "err", err, "messages", len(messages))
+		for range messages {
+			countDropped(dropStageExporter)
+		}
+	}
+	k.record(err)
+}
+
+func (k *kafkaExporter) Update(data healthData, updatedKey string) error {
+	// The receivers may still send updates during shutdown, which the closed writer would reject
+	if k.ctx.Err() != nil {
+		return nil
+	}
+	msg := wsUpdateMessage{Data: data, UpdatedKey: updatedKey}
+	b, err := json.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("encoding kafka message: %v", err)
+	}
+	// Queues the message, with delivery results reported to completed. It fails early only if
+	// the topic metadata cannot be fetched.
+	err = k.writer.WriteMessages(context.Background(), kafka.Message{
+		Key:   []byte(updatedKey),
+		Value: b,
+	})
+	if err != nil {
+		err = fmt.Errorf("writing kafka message: %v", err)
+		k.record(err)
+		return err
+	}
+	return nil
+}
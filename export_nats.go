@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+)
+
+type natsExporter struct {
+	conn     *nats.Conn
+	subject  string
+	perField bool
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "nats",
+		description: "NATS publisher of update messages",
+		flags:       []string{"nats-enabled", "nats-url", "nats-subject", "nats-per-field"},
+		create: func(_ *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("NATS enabled", "url", cfg.String("url"), "subject", cfg.String("subject"))
+			return newNATSExporter(cfg.String("url"), cfg.String("subject"), cfg.Bool("per-field"))
+		},
+	})
+}
+
+func newNATSExporter(url, subject string, perField bool) (*natsExporter, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("hds-osc"),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			slog.Warn("NATS disconnected", "err", err)
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			slog.Info("NATS reconnected", "url", c.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %v", err)
+	}
+	slog.Info("NATS exporter configured", "url", url, "subject", subject, "connected", conn.IsConnected())
+
+	return &natsExporter{
+		conn:     conn,
+		subject:  subject,
+		perField: perField,
+	}, nil
+}
+
+func (n *natsExporter) Update(data healthData, updatedKey string) error {
+	msg := wsUpdateMessage{Data: data, UpdatedKey: updatedKey}
+	b, err := json.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("encoding NATS message: %v", err)
+	}
+	if err = n.conn.Publish(n.subject, b); err != nil {
+		return fmt.Errorf("publishing to NATS: %v", err)
+	}
+
+	if !n.perField {
+		return nil
+	}
+	keys := []string{updatedKey}
+	if updatedKey == "all" {
+		keys = healthDataKeys
+	}
+	for _, key := range keys {
+		value, ok := data.Get(key)
+		if !ok {
+			continue
+		}
+		payload := strconv.FormatFloat(value, 'f', -1, 64)
+		if err = n.conn.Publish(n.subject+"."+key, []byte(payload)); err != nil {
+			return fmt.Errorf("publishing to NATS: %v", err)
+		}
+	}
+	return nil
+}
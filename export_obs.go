@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// OBS WebSocket v5 opcodes, see https://github.com/obsproject/obs-websocket/blob/master/docs/generated/protocol.md
+const (
+	obsOpHello      = 0
+	obsOpIdentify   = 1
+	obsOpIdentified = 2
+	obsOpRequest    = 6
+)
+
+type obsMessage struct {
+	Op int `json:"op"`
+	D  any `json:"d"`
+}
+
+type obsHello struct {
+	Op int `json:"op"`
+	D  struct {
+		RPCVersion     int `json:"rpcVersion"`
+		Authentication *struct {
+			Challenge string `json:"challenge"`
+			Salt      string `json:"salt"`
+		} `json:"authentication"`
+	} `json:"d"`
+}
+
+type obsExporter struct {
+	url      string
+	password string
+	source   string
+	format   string
+	interval time.Duration
+
+	conn      *websocket.Conn
+	requestID int
+
+	// pending holds the latest text not yet sent; wake is signalled when it changes
+	pending     string
+	pendingLock sync.Mutex
+	wake        chan struct{}
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "obs",
+		description: "OBS text source updated via OBS WebSocket v5",
+		flags:       []string{"obs-enabled", "obs-url", "obs-password", "obs-source", "obs-format", "obs-min-interval"},
+		keys:        []string{"heartRate"},
+		create: func(_ *exporterEnv, cfg exporterConfig) (exporter, error) {
+			interval, err := cfg.Duration("min-interval")
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("OBS enabled", "url", cfg.String("url"), "source", cfg.String("source"))
+			return newOBSExporter(cfg.String("url"), cfg.String("password"), cfg.String("source"), cfg.String("format"), interval), nil
+		},
+	})
+}
+
+func newOBSExporter(url, password, source, format string, interval time.Duration) *obsExporter {
+	o := &obsExporter{
+		url:      url,
+		password: password,
+		source:   source,
+		format:   format,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+	}
+	go o.sendLoop()
+	return o
+}
+
+func (o *obsExporter) Update(data healthData, _ string) error {
+	text := strings.NewReplacer(
+		"{hr}", strconv.Itoa(data.HeartRate),
+		"{steps}", strconv.Itoa(data.StepCount),
+		"{calories}", strconv.Itoa(data.Calories),
+	).Replace(o.format)
+
+	o.pendingLock.Lock()
+	o.pending = text
+	o.pendingLock.Unlock()
+	select {
+	case o.wake <- struct{}{}:
+	default:
+		// A previous text is still pending, and is replaced by this one
+		countDropped(dropStageThrottle)
+	}
+	return nil
+}
+
+// sendLoop sends the latest pending text at most once per interval, so that
+// fast updates are coalesced instead of hammering the OBS socket.
+func (o *obsExporter) sendLoop() {
+	for range o.wake {
+		o.pendingLock.Lock()
+		text := o.pending
+		o.pendingLock.Unlock()
+
+		if err := o.setText(text); err != nil {
+			slog.Error("Updating OBS text source", "err", err)
+		}
+		time.Sleep(o.interval)
+	}
+}
+
+func (o *obsExporter) setText(text string) error {
+	if o.conn == nil {
+		if err := o.connect(); err != nil {
+			return err
+		}
+	}
+
+	o.requestID++
+	req := obsMessage{Op: obsOpRequest, D: map[string]any{
+		"requestType": "SetInputSettings",
+		"requestId":   strconv.Itoa(o.requestID),
+		"requestData": map[string]any{
+			"inputName":     o.source,
+			"inputSettings": map[string]any{"text": text},
+		},
+	}}
+	if err := o.conn.WriteJSON(&req); err != nil {
+		// OBS probably restarted; reconnect on the next update
+		_ = o.conn.Close()
+		o.conn = nil
+		return fmt.Errorf("writing OBS request: %v", err)
+	}
+	return nil
+}
+
+func (o *obsExporter) connect() error {
+	conn, _, err := websocket.DefaultDialer.Dial(o.url, nil)
+	if err != nil {
+		return fmt.Errorf("dialing OBS websocket: %v", err)
+	}
+
+	var hello obsHello
+	if err = conn.ReadJSON(&hello); err != nil || hello.Op != obsOpHello {
+		_ = conn.Close()
+		return fmt.Errorf("reading OBS hello: %v", err)
+	}
+
+	identify := map[string]any{"rpcVersion": 1}
+	if auth := hello.D.Authentication; auth != nil {
+		if o.password == "" {
+			_ = conn.Close()
+			return errors.New("OBS requires a password")
+		}
+		secret := obsSHA256Base64(o.password + auth.Salt)
+		identify["authentication"] = obsSHA256Base64(secret + auth.Challenge)
+	}
+	if err = conn.WriteJSON(&obsMessage{Op: obsOpIdentify, D: identify}); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("writing OBS identify: %v", err)
+	}
+
+	var identified obsMessage
+	if err = conn.ReadJSON(&identified); err != nil || identified.Op != obsOpIdentified {
+		_ = conn.Close()
+		return fmt.Errorf("OBS identification failed: %v", err)
+	}
+
+	// Discard request responses; a read error means the connection is gone
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	slog.Info("OBS websocket connected", "url", o.url)
+	o.conn = conn
+	return nil
+}
+
+func obsSHA256Base64(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
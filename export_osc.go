@@ -0,0 +1,1116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bep/debounce"
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// oscProfile holds the avatar-specific OSC settings, switchable at runtime.
+type oscProfile struct {
+	// Addr receives the heart rate normalized into [0, 1] over [HRMin, HRMax], unless HRFloatEnabled is false
+	Addr           string  `yaml:"addr"`
+	HRFloatEnabled bool    `yaml:"hr-float-enabled"`
+	HRMin          float64 `yaml:"hr-min"`
+	HRMax          float64 `yaml:"hr-max"`
+	// StaleValue is sent on Addr when data becomes stale, or "hold" to keep the last value
+	StaleValue string `yaml:"stale-value"`
+	// HRStringAddr receives the BPM as a string formatted by HRStringFormat, if set
+	HRStringAddr   string `yaml:"hr-string-addr"`
+	HRStringFormat string `yaml:"hr-string-format"`
+	EnableAddr     string `yaml:"enable-addr"`
+	// FieldAddrs receives the raw values of fields other than heart rate, keyed by field name
+	FieldAddrs map[string]string `yaml:"field-addrs"`
+	// AddrTemplate generates the FieldAddrs not set explicitly, see fieldAddr
+	AddrTemplate string `yaml:"addr-template"`
+	// FieldOnStale is the oscEntry.OnStale of the FieldAddrs, AddrTemplate, StepsNormAddr and
+	// CaloriesNormAddr addresses, keyed by field name. Fields not set hold their last value.
+	FieldOnStale map[string]string `yaml:"field-on-stale"`
+	// Entries are additional addresses, each with their own type and transform
+	Entries []oscEntry `yaml:"entries"`
+	// StepPulseAddr receives a brief true pulse each time StepsPerPulse steps accrued, if set
+	StepPulseAddr string `yaml:"step-pulse-addr"`
+	StepsPerPulse int    `yaml:"steps-per-pulse"`
+	// CalorieRateAddr receives the calorie burn rate normalized into [0, 1] over [0, CalorieRateMax] kcal/min, if set
+	CalorieRateAddr string  `yaml:"calorie-rate-addr"`
+	CalorieRateMax  float64 `yaml:"calorie-rate-max"`
+	// StepsNormAddr and CaloriesNormAddr receive the totals normalized into [0, 1] over [0, StepsMax]
+	// and [0, CaloriesMax], if set
+	StepsNormAddr    string  `yaml:"steps-norm-addr"`
+	StepsMax         float64 `yaml:"steps-max"`
+	CaloriesNormAddr string  `yaml:"calories-norm-addr"`
+	CaloriesMax      float64 `yaml:"calories-max"`
+	// AlarmAddr receives a brief true pulse when the heart rate crosses above AlarmHR, if set; see hrAlarm
+	AlarmAddr       string        `yaml:"alarm-addr"`
+	AlarmHR         float64       `yaml:"alarm-hr"`
+	AlarmHysteresis float64       `yaml:"alarm-hysteresis"`
+	AlarmCooldown   time.Duration `yaml:"alarm-cooldown"`
+}
+
+// oscEntry sends a field's value to Addr, transformed and then converted to Type.
+type oscEntry struct {
+	Addr string `yaml:"addr"`
+	// Field defaults to heartRate
+	Field string `yaml:"field"`
+	// Type is one of float, int, bool (true for non-zero values)
+	Type string `yaml:"type"`
+	// Transform is one of raw, normalized (heart rate, steps or calories, over the profile's range),
+	// or a threshold like ">150" or "<60" giving 1 when met and 0 otherwise
+	Transform string `yaml:"transform"`
+	// OnStale is what is sent once when data becomes stale: hold (the default) to keep the last
+	// value, zero, or a sentinel number, sent as is converted to Type
+	OnStale string `yaml:"on-stale"`
+}
+
+func (e *oscEntry) field() string {
+	return lo.Ternary(e.Field != "", e.Field, "heartRate")
+}
+
+func (e *oscEntry) validate() error {
+	if e.Addr == "" {
+		return fmt.Errorf("addr is required")
+	}
+	if !lo.Contains(healthDataKeys, e.field()) {
+		return fmt.Errorf("%s: unknown field %q", e.Addr, e.Field)
+	}
+	if !lo.Contains([]string{"float", "int", "bool"}, e.Type) {
+		return fmt.Errorf("%s: unknown type %q", e.Addr, e.Type)
+	}
+	switch {
+	case e.Transform == "raw":
+	case e.Transform == "normalized":
+		if !lo.Contains(oscNormalizedFields, e.field()) {
+			return fmt.Errorf("%s: normalized is only supported for %v", e.Addr, oscNormalizedFields)
+		}
+	case strings.HasPrefix(e.Transform, ">"), strings.HasPrefix(e.Transform, "<"):
+		if _, err := strconv.ParseFloat(e.Transform[1:], 64); err != nil {
+			return fmt.Errorf("%s: invalid threshold %q", e.Addr, e.Transform)
+		}
+	default:
+		return fmt.Errorf("%s: unknown transform %q", e.Addr, e.Transform)
+	}
+	if !validOnStale(e.OnStale) {
+		return fmt.Errorf("%s: on-stale must be hold, zero or a number, got %q", e.Addr, e.OnStale)
+	}
+	return nil
+}
+
+// validOnStale reports whether v is an oscEntry.OnStale policy.
+func validOnStale(v string) bool {
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil || lo.Contains([]string{"", "hold", "zero"}, v)
+}
+
+// message builds the OSC message for the entry from data.
+func (e *oscEntry) message(p *oscProfile, data healthData) *osc.Message {
+	value, _ := data.Get(e.field())
+	switch {
+	case e.Transform == "normalized":
+		value = p.normalizeField(e.field(), data)
+	case strings.HasPrefix(e.Transform, ">"):
+		threshold, _ := strconv.ParseFloat(e.Transform[1:], 64)
+		value = lo.Ternary(value > threshold, 1.0, 0.0)
+	case strings.HasPrefix(e.Transform, "<"):
+		threshold, _ := strconv.ParseFloat(e.Transform[1:], 64)
+		value = lo.Ternary(value < threshold, 1.0, 0.0)
+	}
+	return e.typedMessage(value)
+}
+
+// staleMessage builds the OSC message sent when data becomes stale, or nil to hold the last value.
+func (e *oscEntry) staleMessage() *osc.Message {
+	switch e.OnStale {
+	case "", "hold":
+		return nil
+	case "zero":
+		return e.typedMessage(0)
+	default:
+		sentinel, _ := strconv.ParseFloat(e.OnStale, 64)
+		return e.typedMessage(sentinel)
+	}
+}
+
+func (e *oscEntry) typedMessage(value float64) *osc.Message {
+	switch e.Type {
+	case "int":
+		return osc.NewMessage(e.Addr, int32(value))
+	case "bool":
+		return osc.NewMessage(e.Addr, value != 0)
+	default:
+		return osc.NewMessage(e.Addr, float32(value))
+	}
+}
+
+// entries returns all addresses sent by the profile, including the Addr and FieldAddrs shorthands.
+func (p *oscProfile) entries() []oscEntry {
+	var entries []oscEntry
+	if p.HRFloatEnabled {
+		entries = append(entries, oscEntry{Addr: p.Addr, Field: "heartRate", Type: "float", Transform: "normalized", OnStale: p.StaleValue})
+	}
+	for _, field := range healthDataKeys {
+		if addr, ok := p.fieldAddr(field); ok && field != "heartRate" {
+			entries = append(entries, oscEntry{Addr: addr, Field: field, Type: "float", Transform: "raw", OnStale: p.FieldOnStale[field]})
+		}
+	}
+	if p.StepsNormAddr != "" {
+		entries = append(entries, oscEntry{Addr: p.StepsNormAddr, Field: "stepCount", Type: "float", Transform: "normalized", OnStale: p.FieldOnStale["stepCount"]})
+	}
+	if p.CaloriesNormAddr != "" {
+		entries = append(entries, oscEntry{Addr: p.CaloriesNormAddr, Field: "calories", Type: "float", Transform: "normalized", OnStale: p.FieldOnStale["calories"]})
+	}
+	return append(entries, p.Entries...)
+}
+
+// oscFieldPlaceholder is replaced in address templates by the capitalized field name.
+const oscFieldPlaceholder = "{field}"
+
+// fieldAddr returns the address for the raw value of field, from FieldAddrs or else
+// from AddrTemplate, e.g. "/avatar/parameters/HDS_{field}" gives "/avatar/parameters/HDS_StepCount".
+func (p *oscProfile) fieldAddr(field string) (string, bool) {
+	if addr, ok := p.FieldAddrs[field]; ok {
+		return addr, true
+	}
+	if p.AddrTemplate == "" {
+		return "", false
+	}
+	return strings.ReplaceAll(p.AddrTemplate, oscFieldPlaceholder, strings.ToUpper(field[:1])+field[1:]), true
+}
+
+// oscTypeTags maps entry types to OSC type tags.
+var oscTypeTags = map[string]string{"float": "f", "int": "i", "bool": "T"}
+
+// addresses lists the addresses sent with the active profile, with their types.
+func (o *oscExporter) addresses() []oscAddress {
+	p := o.profile()
+	var addrs []oscAddress
+	for _, e := range p.entries() {
+		if lo.Contains(o.fields, e.field()) {
+			addrs = append(addrs, oscAddress{Addr: e.Addr, Type: oscTypeTags[e.Type], Access: oscQueryAccessRead})
+		}
+	}
+	if p.HRStringAddr != "" && lo.Contains(o.fields, "heartRate") {
+		addrs = append(addrs, oscAddress{Addr: p.HRStringAddr, Type: "s", Access: oscQueryAccessRead})
+	}
+	if p.StepPulseAddr != "" && lo.Contains(o.fields, "stepCount") {
+		addrs = append(addrs, oscAddress{Addr: p.StepPulseAddr, Type: "T", Access: oscQueryAccessRead})
+	}
+	if p.CalorieRateAddr != "" && lo.Contains(o.fields, "calories") {
+		addrs = append(addrs, oscAddress{Addr: p.CalorieRateAddr, Type: "f", Access: oscQueryAccessRead})
+	}
+	if p.AlarmAddr != "" && lo.Contains(o.fields, "heartRate") {
+		addrs = append(addrs, oscAddress{Addr: p.AlarmAddr, Type: "T", Access: oscQueryAccessRead})
+	}
+	if p.EnableAddr != "" {
+		addrs = append(addrs, oscAddress{Addr: p.EnableAddr, Type: "T", Access: oscQueryAccessRead})
+	}
+	return addrs
+}
+
+// parseOSCEntries parses "addr=type:transform[:field[:on-stale]]" entries, separated by commas.
+func parseOSCEntries(s string) ([]oscEntry, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var entries []oscEntry
+	for _, entry := range strings.Split(s, ",") {
+		addr, spec, ok := strings.Cut(entry, "=")
+		parts := strings.Split(spec, ":")
+		if !ok || len(parts) < 2 || len(parts) > 4 {
+			return nil, fmt.Errorf("invalid entry %q", entry)
+		}
+		e := oscEntry{Addr: addr, Type: parts[0], Transform: parts[1]}
+		if len(parts) >= 3 {
+			e.Field = parts[2]
+		}
+		if len(parts) == 4 {
+			e.OnStale = parts[3]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseOSCFieldAddrs parses "stepCount=/avatar/parameters/Steps,calories=/avatar/parameters/Calories" style mappings.
+func parseOSCFieldAddrs(s string) (map[string]string, error) {
+	return parseOSCFieldMap(s, "field address")
+}
+
+// parseOSCFieldOnStale parses "stepCount=zero,calories=-1" style mappings of on-stale policies.
+func parseOSCFieldOnStale(s string) (map[string]string, error) {
+	return parseOSCFieldMap(s, "field on-stale")
+}
+
+// parseOSCFieldMap parses comma-separated "field=value" pairs, what naming a value in errors.
+func parseOSCFieldMap(s, what string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, value, ok := strings.Cut(pair, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid %s %q", what, pair)
+		}
+		m[field] = value
+	}
+	return m, nil
+}
+
+// parseOSCBindAddr parses an "ip" or "ip:port" local address, port 0 picking any free port.
+// Binding the source address selects the interface packets leave from, which matters when
+// the default route goes through a VPN or virtual adapter that the OSC receiver is not on.
+func parseOSCBindAddr(s string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		// No port given
+		host, portStr = s, "0"
+	}
+	if net.ParseIP(host) == nil {
+		return "", 0, fmt.Errorf("invalid IP %q", host)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", portStr)
+	}
+	return host, port, nil
+}
+
+// parseOSCFields parses a comma-separated list of fields to send over OSC.
+func parseOSCFields(s string) ([]string, error) {
+	fields := strings.Split(s, ",")
+	for _, field := range fields {
+		if !lo.Contains(healthDataKeys, field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return fields, nil
+}
+
+// sendsHeartRate reports whether any address of the profile is driven by the heart rate.
+func (p *oscProfile) sendsHeartRate() bool {
+	return p.HRStringAddr != "" || lo.ContainsBy(p.entries(), func(e oscEntry) bool { return e.field() == "heartRate" })
+}
+
+// normalize maps a heart rate into [0, 1] over the profile's range.
+func (p *oscProfile) normalize(hr float64) float64 {
+	return min(max((hr-p.HRMin)/(p.HRMax-p.HRMin), 0), 1)
+}
+
+// oscNormalizedFields are the fields supporting the normalized transform.
+var oscNormalizedFields = []string{"heartRate", "stepCount", "calories"}
+
+// normalizeField maps the value of one of oscNormalizedFields into [0, 1] over the profile's range.
+func (p *oscProfile) normalizeField(field string, data healthData) float64 {
+	switch field {
+	case "stepCount":
+		return min(max(float64(data.StepCount)/p.StepsMax, 0), 1)
+	case "calories":
+		return min(max(float64(data.Calories)/p.CaloriesMax, 0), 1)
+	default:
+		return p.normalize(data.HeartRateValue())
+	}
+}
+
+func (p *oscProfile) validate() error {
+	if p.Addr == "" {
+		return fmt.Errorf("addr is required")
+	}
+	if _, err := strconv.ParseFloat(p.StaleValue, 64); err != nil && p.StaleValue != "hold" {
+		return fmt.Errorf("stale-value must be a number or hold, got %q", p.StaleValue)
+	}
+	if p.HRMax <= p.HRMin {
+		return fmt.Errorf("hr-max (%v) must be greater than hr-min (%v)", p.HRMax, p.HRMin)
+	}
+	for field := range p.FieldAddrs {
+		if field == "heartRate" || !lo.Contains(healthDataKeys, field) {
+			return fmt.Errorf("field-addrs: unsupported field %q", field)
+		}
+	}
+	for field, onStale := range p.FieldOnStale {
+		if field == "heartRate" || !lo.Contains(healthDataKeys, field) {
+			return fmt.Errorf("field-on-stale: unsupported field %q, the heart rate uses stale-value", field)
+		}
+		if !validOnStale(onStale) {
+			return fmt.Errorf("field-on-stale: %s must be hold, zero or a number, got %q", field, onStale)
+		}
+	}
+	if p.AddrTemplate != "" && !strings.Contains(p.AddrTemplate, oscFieldPlaceholder) {
+		return fmt.Errorf("addr-template: %q has no %s placeholder", p.AddrTemplate, oscFieldPlaceholder)
+	}
+	for _, e := range p.Entries {
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("entries: %v", err)
+		}
+	}
+	if p.StepPulseAddr != "" && p.StepsPerPulse < 1 {
+		return fmt.Errorf("steps-per-pulse must be at least 1, got %d", p.StepsPerPulse)
+	}
+	if p.CalorieRateAddr != "" && p.CalorieRateMax <= 0 {
+		return fmt.Errorf("calorie-rate-max must be positive, got %v", p.CalorieRateMax)
+	}
+	if p.StepsMax <= 0 || p.CaloriesMax <= 0 {
+		return fmt.Errorf("steps-max and calories-max must be positive, got %v and %v", p.StepsMax, p.CaloriesMax)
+	}
+	if p.AlarmAddr != "" && (p.AlarmHR <= 0 || p.AlarmHysteresis < 0 || p.AlarmCooldown < 0) {
+		return fmt.Errorf("alarm-hr must be positive, and alarm-hysteresis and alarm-cooldown not negative")
+	}
+	return nil
+}
+
+// buildOSCProfiles returns the "default" profile built from flags, together with the
+// profiles from the config file. Fields omitted in a config profile fall back to the default.
+func buildOSCProfiles(defaultProfile oscProfile, nodes map[string]yaml.Node) (map[string]oscProfile, error) {
+	profiles := map[string]oscProfile{"default": defaultProfile}
+	for name, node := range nodes {
+		p := defaultProfile
+		// Decoding writes into the existing map rather than replacing it, so it must not be shared
+		p.FieldAddrs = maps.Clone(defaultProfile.FieldAddrs)
+		p.FieldOnStale = maps.Clone(defaultProfile.FieldOnStale)
+		p.Entries = slices.Clone(defaultProfile.Entries)
+		if err := node.Decode(&p); err != nil {
+			return nil, fmt.Errorf("osc profile %q: %v", name, err)
+		}
+		profiles[name] = p
+	}
+	for name, p := range profiles {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("osc profile %q: %v", name, err)
+		}
+		if !p.sendsHeartRate() {
+			slog.Warn("OSC profile sends no heart rate address", "profile", name)
+		}
+	}
+	return profiles, nil
+}
+
+// enableGate holds back the enabled state until minSamples updates arrived,
+// each within window of the previous one, so that a stray packet does not flip it.
+type enableGate struct {
+	minSamples int
+	window     time.Duration
+
+	lock    sync.Mutex
+	enabled bool
+	count   int
+	last    time.Time
+}
+
+// sample records an update at t, and reports whether the enabled state should be sent.
+func (g *enableGate) sample(t time.Time) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if !g.enabled {
+		if t.Sub(g.last) > g.window {
+			g.count = 0
+		}
+		g.count++
+		g.last = t
+		g.enabled = g.count >= g.minSamples
+	}
+	return g.enabled
+}
+
+func (g *enableGate) reset() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.enabled = false
+	g.count = 0
+}
+
+// oscPulseDuration is how long pulse addresses, e.g. the step pulse, stay true.
+const oscPulseDuration = 100 * time.Millisecond
+
+// stepCounter accumulates step count increases, to pulse once every N steps.
+type stepCounter struct {
+	lock    sync.Mutex
+	seen    bool
+	last    int
+	accrued int
+}
+
+// add records the current step count, and reports whether perPulse steps accrued since the last pulse.
+// A decreasing count is taken as a counter reset, e.g. at midnight, and does not pulse.
+func (c *stepCounter) add(count, perPulse int) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.seen || count < c.last {
+		c.seen, c.last = true, count
+		return false
+	}
+	c.accrued += count - c.last
+	c.last = count
+	if c.accrued < perPulse {
+		return false
+	}
+	c.accrued %= perPulse
+	return true
+}
+
+// hrAlarm fires when the heart rate crosses above a profile's alarm threshold. It rearms once
+// the heart rate dropped below the threshold minus the hysteresis, and fires at most once per cooldown.
+type hrAlarm struct {
+	lock  sync.Mutex
+	armed hrThresholdAlerter
+	last  time.Time
+}
+
+// check feeds the heart rate at t, and reports whether the alarm fires.
+func (a *hrAlarm) check(p *oscProfile, hr float64, t time.Time) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.armed.SetThresholds(p.AlarmHR, 0, p.AlarmHysteresis)
+	if a.armed.Check(hr) != hrAlertHigh || t.Sub(a.last) < p.AlarmCooldown {
+		return false
+	}
+	a.last = t
+	return true
+}
+
+type oscExporter struct {
+	// client is replaced by SetTarget, the local address is kept
+	client     *osc.Client
+	bindAddr   string
+	clientLock sync.Mutex
+	// fields lists the fields sent, the others are ignored even if their address is configured
+	fields []string
+	// bundle sends the messages queued together in one bundle, instead of one by one
+	bundle bool
+	// fixedRate, if non-zero, is how many times per second the latest values are sent, instead
+	// of on each update. fixedRateData is the data sent, nil while disabled.
+	fixedRate     float64
+	fixedRateData *healthData
+	fixedRateLock sync.Mutex
+
+	profiles    map[string]oscProfile
+	active      oscProfile
+	activeName  string
+	profileLock sync.RWMutex
+
+	disableLater func()
+	enable       *enableGate
+	steps        stepCounter
+	alarm        hrAlarm
+
+	calorieRate     rateTracker
+	calorieRateLock sync.Mutex
+
+	// last is the latest data of the fields sent, for the normalization stats
+	last     healthData
+	lastLock sync.Mutex
+
+	// muted stops all sends, toggled by OSC control messages
+	muted atomic.Bool
+
+	// pending holds the latest message per address not yet sent, in first queued order.
+	// wake is signalled when it changes.
+	pending      map[string]*osc.Message
+	pendingOrder []string
+	pendingLock  sync.Mutex
+	wake         chan struct{}
+
+	// debugFile, if set, gets a line per message sent, closed when sendLoop stops
+	debugFile *os.File
+
+	// Sends happen in sendLoop, so health is tracked there rather than from Update
+	healthTracker
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "osc",
+		description: "OSC messages, e.g. to VRChat avatar parameters, with the addresses from the OSC profiles",
+		flags: []string{"osc-enabled", "osc-ip", "osc-port", "osc-bind-addr", "osc-active-profile", "osc-fields", "osc-bundle", "osc-fixed-rate", "osc-debug-file",
+			"osc-enable-debounce", "osc-enable-min-samples", "osc-enable-window",
+			"osc-listen-port", "osc-control-addr", "osc-control-disable", "oscquery-enabled", "oscquery-port"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			enableDebounce, err := cfg.Duration("enable-debounce")
+			if err != nil {
+				return nil, err
+			}
+			enableWindow, err := cfg.Duration("enable-window")
+			if err != nil {
+				return nil, err
+			}
+			fields, err := parseOSCFields(cfg.String("fields"))
+			if err != nil {
+				return nil, err
+			}
+
+			slog.Info("OSC enabled", "ip", cfg.String("ip"), "port", cfg.Int("port"), "profile", cfg.String("active-profile"))
+			e, err := newOSCExporter(env.ctx, env.shutdown, cfg.String("ip"), cfg.Int("port"), cfg.String("bind-addr"), env.oscProfiles, cfg.String("active-profile"), fields, cfg.Bool("bundle"), cfg.Float64("fixed-rate"), cfg.String("debug-file"), enableDebounce, cfg.Int("enable-min-samples"), enableWindow)
+			if err != nil {
+				return nil, err
+			}
+			env.oscExp = e
+			if port := cfg.Int("listen-port"); port != 0 {
+				env.shutdown.Add(1)
+				go func() {
+					defer env.shutdown.Done()
+					if err := e.ListenControl(env.ctx, port, cfg.String("control-addr"), cfg.Bool("control-disable")); err != nil {
+						slog.Error("OSC control listener", "err", err)
+					}
+				}()
+			}
+			if cfg.Bool("oscquery-enabled") {
+				if err := startOSCQuery(env.ctx, env.shutdown, e, cfg.Int("oscquery-port"), cfg.Int("listen-port"), cfg.String("control-addr")); err != nil {
+					return nil, fmt.Errorf("starting OSCQuery server: %v", err)
+				}
+			}
+			return e, nil
+		},
+	})
+}
+
+// newOSCExporter creates an exporter sending from its own goroutine, so that Update never blocks.
+// Messages still queued when ctx is cancelled are sent before shutdown completes.
+func newOSCExporter(ctx context.Context, shutdown *sync.WaitGroup, sendIP string, sendPort int, bindAddr string, profiles map[string]oscProfile, activeProfile string, fields []string, bundle bool, fixedRate float64, debugFile string, enableDebounce time.Duration, enableMinSamples int, enableWindow time.Duration) (*oscExporter, error) {
+	client, err := newOSCClient(sendIP, sendPort, bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	var debug *os.File
+	if debugFile != "" {
+		debug, err = os.OpenFile(debugFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening OSC debug file: %v", err)
+		}
+		slog.Info("OSC debug file enabled", "file", debugFile)
+	}
+
+	o := &oscExporter{
+		client:    client,
+		bindAddr:  bindAddr,
+		fields:    fields,
+		bundle:    bundle,
+		fixedRate: fixedRate,
+		debugFile: debug,
+		enable:    &enableGate{minSamples: enableMinSamples, window: enableWindow},
+		profiles:  profiles,
+		pending:   map[string]*osc.Message{},
+		wake:      make(chan struct{}, 1),
+	}
+	if err := o.SetProfile(activeProfile); err != nil {
+		if debug != nil {
+			debug.Close()
+		}
+		return nil, err
+	}
+	registerStats("oscNormalization", o.normalizationStats)
+	slog.Info("OSC config", "profile", activeProfile, "addr", o.active.Addr, "fields", fields, "ip", sendIP+":"+strconv.Itoa(sendPort))
+
+	disable := func() {
+		o.enable.reset()
+		o.setFixedRateData(nil)
+		err := o.sendEnabled(false)
+		if err != nil {
+			slog.Error("Sending OSC message", "err", err)
+		}
+	}
+	debounced := debounce.New(enableDebounce)
+	o.disableLater = func() {
+		debounced(disable)
+	}
+
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		o.sendLoop(ctx)
+		if debug != nil {
+			debug.Close()
+		}
+	}()
+	if fixedRate > 0 {
+		go o.sendFixedRate(ctx)
+	}
+	return o, nil
+}
+
+func (o *oscExporter) profile() oscProfile {
+	o.profileLock.RLock()
+	defer o.profileLock.RUnlock()
+	return o.active
+}
+
+// SetProfiles replaces the available profiles, e.g. on config reload.
+// The active profile is kept by name, falling back to "default" if it was removed.
+func (o *oscExporter) SetProfiles(profiles map[string]oscProfile) error {
+	o.profileLock.Lock()
+	o.profiles = profiles
+	name := o.activeName
+	o.profileLock.Unlock()
+
+	if _, ok := profiles[name]; !ok {
+		slog.Warn("Active OSC profile removed, switching to default", "profile", name)
+		name = "default"
+	}
+	return o.SetProfile(name)
+}
+
+// newOSCClient returns a client sending to ip:port, from bindAddr if set.
+func newOSCClient(ip string, port int, bindAddr string) (*osc.Client, error) {
+	client := osc.NewClient(ip, port)
+	if bindAddr != "" {
+		localIP, localPort, err := parseOSCBindAddr(bindAddr)
+		if err == nil {
+			err = client.SetLocalAddr(localIP, localPort)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid OSC bind address: %v", err)
+		}
+	}
+	return client, nil
+}
+
+// SetTarget switches the destination of the OSC messages, e.g. after VRChat restarted on another port.
+// Queued messages are sent to the new destination.
+func (o *oscExporter) SetTarget(ip string, port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("invalid OSC port %d", port)
+	}
+	o.clientLock.Lock()
+	defer o.clientLock.Unlock()
+	if ip == o.client.IP() && port == o.client.Port() {
+		return nil
+	}
+	client, err := newOSCClient(ip, port, o.bindAddr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Switched OSC target", "from", o.client.IP()+":"+strconv.Itoa(o.client.Port()), "to", ip+":"+strconv.Itoa(port))
+	o.client = client
+	return nil
+}
+
+// target returns the client for the current destination.
+func (o *oscExporter) target() *osc.Client {
+	o.clientLock.Lock()
+	defer o.clientLock.Unlock()
+	return o.client
+}
+
+// SetProfile switches the active profile.
+func (o *oscExporter) SetProfile(name string) error {
+	o.profileLock.Lock()
+	p, ok := o.profiles[name]
+	if !ok {
+		o.profileLock.Unlock()
+		return fmt.Errorf("unknown osc profile %q", name)
+	}
+	prev, prevName := o.active, o.activeName
+	o.active, o.activeName = p, name
+	o.profileLock.Unlock()
+
+	if prevName != "" && prevName != name {
+		slog.Info("Switched OSC profile", "from", prevName, "to", name)
+		// The previous avatar's parameters are no longer driven
+		if prev.EnableAddr != "" && prev.EnableAddr != p.EnableAddr {
+			return o.send(osc.NewMessage(prev.EnableAddr, false))
+		}
+	}
+	return nil
+}
+
+// handleControl applies WebSocket control messages addressed to the OSC exporter.
+func (o *oscExporter) handleControl(msg wsControlMessage) error {
+	if msg.OSCPort != 0 {
+		ip := msg.OSCIP
+		if ip == "" {
+			ip = o.target().IP()
+		}
+		if err := o.SetTarget(ip, msg.OSCPort); err != nil {
+			return err
+		}
+	}
+	if msg.OSCProfile == "" {
+		return nil
+	}
+	return o.SetProfile(msg.OSCProfile)
+}
+
+// ListenControl receives OSC control messages on port until ctx is cancelled.
+// A true value on controlAddr unmutes sends and false mutes them, optionally
+// also sending the disabled state right away.
+func (o *oscExporter) ListenControl(ctx context.Context, port int, controlAddr string, disableOnMute bool) error {
+	conn, err := net.ListenPacket("udp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return fmt.Errorf("listening OSC control port: %v", err)
+	}
+
+	d := osc.NewStandardDispatcher()
+	err = d.AddMsgHandler(controlAddr, func(msg *osc.Message) {
+		if len(msg.Arguments) == 0 {
+			return
+		}
+		var enabled bool
+		switch v := msg.Arguments[0].(type) {
+		case bool:
+			enabled = v
+		case int32:
+			enabled = v != 0
+		case float32:
+			enabled = v >= 0.5
+		default:
+			slog.Warn("Unsupported OSC control value", "msg", msg)
+			return
+		}
+
+		if o.muted.Swap(!enabled) == !enabled {
+			return
+		}
+		slog.Info("OSC sends toggled by control message", "enabled", enabled)
+		if !enabled && disableOnMute {
+			if err := o.sendEnabledUnmuted(false); err != nil {
+				slog.Error("Sending OSC message", "err", err)
+			}
+		}
+	})
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	slog.Info("OSC control listening...", "port", port, "addr", controlAddr)
+	server := &osc.Server{Dispatcher: d}
+	err = server.Serve(conn)
+	if ctx.Err() != nil {
+		slog.Info("OSC control listener stopped")
+		return nil
+	}
+	return err
+}
+
+func (o *oscExporter) sendEnabled(enabled bool) error {
+	if o.muted.Load() {
+		return nil
+	}
+	return o.sendEnabledUnmuted(enabled)
+}
+
+func (o *oscExporter) sendEnabledUnmuted(enabled bool) error {
+	p := o.profile()
+	if p.EnableAddr == "" {
+		return nil
+	}
+	return o.send(osc.NewMessage(p.EnableAddr, enabled))
+}
+
+func (o *oscExporter) Update(data healthData, updatedKey string) error {
+	if updatedKey == disconnectedKey {
+		return o.sendStale()
+	}
+	keys := o.fields
+	if updatedKey != "all" {
+		if !lo.Contains(o.fields, updatedKey) {
+			return nil
+		}
+		keys = []string{updatedKey}
+	}
+	o.lastLock.Lock()
+	o.last = data
+	o.lastLock.Unlock()
+	if o.muted.Load() {
+		return nil
+	}
+
+	p := o.profile()
+	if p.CalorieRateAddr != "" && lo.Contains(keys, "calories") {
+		o.calorieRateLock.Lock()
+		o.calorieRate.Update(float64(data.Calories), data.Time)
+		o.calorieRateLock.Unlock()
+	}
+	values := o.valueMessages(&p, data, keys)
+	var msgs []*osc.Message
+	if o.fixedRate > 0 {
+		// The values are sent by sendFixedRate instead
+		o.setFixedRateData(&data)
+	} else {
+		msgs = values
+	}
+	if p.StepPulseAddr != "" && lo.Contains(keys, "stepCount") && o.steps.add(data.StepCount, p.StepsPerPulse) {
+		msgs = append(msgs, o.pulse(p.StepPulseAddr))
+	}
+	if p.AlarmAddr != "" && lo.Contains(keys, "heartRate") && o.alarm.check(&p, data.HeartRateValue(), time.Now()) {
+		msgs = append(msgs, o.pulse(p.AlarmAddr))
+	}
+	if len(values) == 0 && len(msgs) == 0 {
+		return nil
+	}
+
+	if p.EnableAddr != "" && o.enable.sample(time.Now()) {
+		msgs = append([]*osc.Message{osc.NewMessage(p.EnableAddr, true)}, msgs...)
+	}
+	o.disableLater()
+	if len(msgs) == 0 {
+		return nil
+	}
+	return o.send(msgs...)
+}
+
+// oscNormalizationStats is the oscNormalization section of GET /stats: the latest raw values
+// and what they map to with the active profile's ranges. Values are nil before any data.
+type oscNormalizationStats struct {
+	Profile             string   `json:"profile"`
+	HRFloatEnabled      bool     `json:"hrFloatEnabled"`
+	HRMin               float64  `json:"hrMin"`
+	HRMax               float64  `json:"hrMax"`
+	HeartRate           *float64 `json:"heartRate"`
+	HeartRateNormalized *float64 `json:"heartRateNormalized"`
+	Clamped             bool     `json:"clamped"`
+	StepsMax            float64  `json:"stepsMax"`
+	StepCount           *float64 `json:"stepCount"`
+	StepsNormalized     *float64 `json:"stepsNormalized"`
+	CaloriesMax         float64  `json:"caloriesMax"`
+	Calories            *float64 `json:"calories"`
+	CaloriesNormalized  *float64 `json:"caloriesNormalized"`
+}
+
+func (o *oscExporter) normalizationStats() any {
+	o.profileLock.RLock()
+	p, name := o.active, o.activeName
+	o.profileLock.RUnlock()
+	o.lastLock.Lock()
+	data := o.last
+	o.lastLock.Unlock()
+
+	stats := oscNormalizationStats{
+		Profile:        name,
+		HRFloatEnabled: p.HRFloatEnabled,
+		HRMin:          p.HRMin,
+		HRMax:          p.HRMax,
+		StepsMax:       p.StepsMax,
+		CaloriesMax:    p.CaloriesMax,
+	}
+	if !data.KeyTimes.HeartRate.IsZero() {
+		hr, norm := data.HeartRateValue(), p.normalize(data.HeartRateValue())
+		stats.HeartRate, stats.HeartRateNormalized = &hr, &norm
+		stats.Clamped = hr < p.HRMin || hr > p.HRMax
+	}
+	if !data.KeyTimes.StepCount.IsZero() {
+		steps, norm := float64(data.StepCount), p.normalizeField("stepCount", data)
+		stats.StepCount, stats.StepsNormalized = &steps, &norm
+	}
+	if !data.KeyTimes.Calories.IsZero() {
+		calories, norm := float64(data.Calories), p.normalizeField("calories", data)
+		stats.Calories, stats.CaloriesNormalized = &calories, &norm
+	}
+	return stats
+}
+
+// valueMessages builds the messages for the values of keys in data, without the pulses.
+func (o *oscExporter) valueMessages(p *oscProfile, data healthData, keys []string) []*osc.Message {
+	var msgs []*osc.Message
+	for _, e := range p.entries() {
+		if lo.Contains(keys, e.field()) {
+			msgs = append(msgs, e.message(p, data))
+		}
+	}
+	if p.HRStringAddr != "" && lo.Contains(keys, "heartRate") {
+		msgs = append(msgs, osc.NewMessage(p.HRStringAddr, fmt.Sprintf(p.HRStringFormat, data.HeartRate)))
+	}
+	if p.CalorieRateAddr != "" && lo.Contains(keys, "calories") {
+		o.calorieRateLock.Lock()
+		rate := o.calorieRate.Rate()
+		o.calorieRateLock.Unlock()
+		msgs = append(msgs, osc.NewMessage(p.CalorieRateAddr, float32(min(max(rate/p.CalorieRateMax, 0), 1))))
+	}
+	return msgs
+}
+
+func (o *oscExporter) setFixedRateData(data *healthData) {
+	o.fixedRateLock.Lock()
+	o.fixedRateData = data
+	o.fixedRateLock.Unlock()
+}
+
+// sendFixedRate sends the latest values fixedRate times per second until ctx is cancelled,
+// from the first update until data goes stale or the disabled state is sent.
+func (o *oscExporter) sendFixedRate(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / o.fixedRate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// Queued under the lock, so that values are never queued after the stale ones
+		o.fixedRateLock.Lock()
+		if data := o.fixedRateData; data != nil && !o.muted.Load() {
+			p := o.profile()
+			if msgs := o.valueMessages(&p, *data, o.fields); len(msgs) > 0 {
+				_ = o.send(msgs...)
+			}
+		}
+		o.fixedRateLock.Unlock()
+	}
+}
+
+// pulse returns a true message for addr, and sends false after oscPulseDuration.
+func (o *oscExporter) pulse(addr string) *osc.Message {
+	time.AfterFunc(oscPulseDuration, func() {
+		_ = o.send(osc.NewMessage(addr, false))
+	})
+	return osc.NewMessage(addr, true)
+}
+
+// sendStale sends the values for stale data, once when the data became stale: a zero
+// calorie rate, deriving it anew afterwards, and the on-stale value of each address not held.
+func (o *oscExporter) sendStale() error {
+	o.setFixedRateData(nil)
+	o.calorieRateLock.Lock()
+	o.calorieRate = rateTracker{}
+	o.calorieRateLock.Unlock()
+
+	if o.muted.Load() {
+		return nil
+	}
+	p := o.profile()
+	var msgs []*osc.Message
+	if p.CalorieRateAddr != "" && lo.Contains(o.fields, "calories") {
+		msgs = append(msgs, osc.NewMessage(p.CalorieRateAddr, float32(0)))
+	}
+	for _, e := range p.entries() {
+		if msg := e.staleMessage(); msg != nil && lo.Contains(o.fields, e.field()) {
+			msgs = append(msgs, msg)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return o.send(msgs...)
+}
+
+// send queues msgs for the sender goroutine. A message still queued for the same
+// address is replaced, so that only the latest state is sent.
+func (o *oscExporter) send(msgs ...*osc.Message) error {
+	o.pendingLock.Lock()
+	for _, msg := range msgs {
+		if _, ok := o.pending[msg.Address]; ok {
+			countDropped(dropStageThrottle)
+		} else {
+			o.pendingOrder = append(o.pendingOrder, msg.Address)
+		}
+		o.pending[msg.Address] = msg
+	}
+	o.pendingLock.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// sendLoop sends queued messages until ctx is cancelled, then sends what is left.
+func (o *oscExporter) sendLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			o.flush()
+			slog.Info("OSC sender stopped")
+			return
+		case <-o.wake:
+			o.flush()
+		}
+	}
+}
+
+func (o *oscExporter) flush() {
+	o.pendingLock.Lock()
+	msgs := make([]*osc.Message, 0, len(o.pendingOrder))
+	for _, addr := range o.pendingOrder {
+		msgs = append(msgs, o.pending[addr])
+	}
+	clear(o.pending)
+	o.pendingOrder = o.pendingOrder[:0]
+	o.pendingLock.Unlock()
+
+	if len(msgs) == 0 {
+		return
+	}
+	if o.bundle {
+		err := o.sendNow(msgs...)
+		if err != nil {
+			slog.Error("Sending OSC bundle", "err", err)
+		}
+		o.record(err)
+		return
+	}
+	for _, msg := range msgs {
+		err := o.sendNow(msg)
+		if err != nil {
+			slog.Error("Sending OSC message", "err", err)
+		}
+		o.record(err)
+	}
+}
+
+// sendNow sends a single message as is, or multiple messages together in one bundle,
+// counting them per address.
+func (o *oscExporter) sendNow(msgs ...*osc.Message) error {
+	err := o.sendPacket(msgs...)
+	counters := lo.Ternary(err == nil, oscPacketsSent, oscSendErrors)
+	for _, msg := range msgs {
+		counters.Inc(msg.Address)
+	}
+	o.writeDebug(msgs, err)
+	return err
+}
+
+// writeDebug appends a line per message to the debug file, with the send time, the address,
+// the type tags and arguments, and the error if sending failed.
+func (o *oscExporter) writeDebug(msgs []*osc.Message, sendErr error) {
+	if o.debugFile == nil {
+		return
+	}
+	var b strings.Builder
+	now := time.Now().Format(time.RFC3339Nano)
+	for _, msg := range msgs {
+		b.WriteString(now + " " + msg.String())
+		if len(msgs) > 1 {
+			b.WriteString(" (bundle)")
+		}
+		if sendErr != nil {
+			b.WriteString(" error: " + sendErr.Error())
+		}
+		b.WriteByte('\n')
+	}
+	if _, err := o.debugFile.WriteString(b.String()); err != nil {
+		slog.Error("Writing OSC debug file", "err", err)
+	}
+}
+
+func (o *oscExporter) sendPacket(msgs ...*osc.Message) error {
+	if len(msgs) == 1 {
+		slog.Debug("Sending OSC message", "msg", msgs[0])
+		return o.target().Send(msgs[0])
+	}
+
+	bundle := osc.NewBundle(time.Now())
+	for _, msg := range msgs {
+		slog.Debug("Bundling OSC message", "msg", msg)
+		if err := bundle.Append(msg); err != nil {
+			return err
+		}
+	}
+	return o.target().Send(bundle)
+}
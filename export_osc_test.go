@@ -0,0 +1,98 @@
+package main
+
+import (
+	"maps"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildOSCProfilesKeepsDefaultFieldAddrs(t *testing.T) {
+	defaultProfile := oscProfile{
+		Addr:        "/avatar/parameters/HR",
+		StaleValue:  "hold",
+		HRMin:       0,
+		HRMax:       255,
+		FieldAddrs:  map[string]string{"stepCount": "/avatar/parameters/Steps"},
+		Entries:     []oscEntry{{Addr: "/avatar/parameters/BPM", Field: "heartRate", Type: "int", Transform: "raw"}},
+		StepsMax:    10000,
+		CaloriesMax: 1000,
+	}
+	var nodes map[string]yaml.Node
+	err := yaml.Unmarshal([]byte(`
+a:
+  field-addrs:
+    calories: /avatar/parameters/A_Calories
+b:
+  field-addrs:
+    speed: /avatar/parameters/B_Speed
+`), &nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := buildOSCProfiles(defaultProfile, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]string{
+		"default": {"stepCount": "/avatar/parameters/Steps"},
+		"a":       {"stepCount": "/avatar/parameters/Steps", "calories": "/avatar/parameters/A_Calories"},
+		"b":       {"stepCount": "/avatar/parameters/Steps", "speed": "/avatar/parameters/B_Speed"},
+	}
+	for name, fieldAddrs := range want {
+		if got := profiles[name].FieldAddrs; !maps.Equal(got, fieldAddrs) {
+			t.Errorf("profile %q field-addrs = %v, want %v", name, got, fieldAddrs)
+		}
+	}
+	if got := defaultProfile.FieldAddrs; len(got) != 1 {
+		t.Errorf("default profile passed in was modified, field-addrs = %v", got)
+	}
+	if got := len(profiles["a"].Entries); got != 1 {
+		t.Errorf("profile %q has %d entries, want 1", "a", got)
+	}
+}
+
+func TestOSCProfileEntriesOnStale(t *testing.T) {
+	p := oscProfile{
+		Addr:             "/avatar/parameters/HR",
+		HRFloatEnabled:   true,
+		StaleValue:       "-1",
+		FieldAddrs:       map[string]string{"stepCount": "/avatar/parameters/Steps"},
+		AddrTemplate:     "/avatar/parameters/HDS_{field}",
+		FieldOnStale:     map[string]string{"stepCount": "zero", "speed": "-1"},
+		StepsNormAddr:    "/avatar/parameters/StepsNorm",
+		CaloriesNormAddr: "/avatar/parameters/CaloriesNorm",
+		Entries:          []oscEntry{{Addr: "/avatar/parameters/BPM", Type: "int", Transform: "raw", OnStale: "zero"}},
+	}
+	want := map[string]any{
+		"/avatar/parameters/HR":                   float32(-1),
+		"/avatar/parameters/Steps":                float32(0),
+		"/avatar/parameters/HDS_DistanceTraveled": nil,
+		"/avatar/parameters/HDS_Speed":            float32(-1),
+		"/avatar/parameters/HDS_Calories":         nil,
+		"/avatar/parameters/StepsNorm":            float32(0),
+		"/avatar/parameters/CaloriesNorm":         nil,
+		"/avatar/parameters/BPM":                  int32(0),
+	}
+
+	entries := p.entries()
+	if len(entries) != len(want) {
+		t.Errorf("entries() returned %d entries, want %d", len(entries), len(want))
+	}
+	for _, e := range entries {
+		wantValue, ok := want[e.Addr]
+		if !ok {
+			t.Errorf("unexpected entry %q", e.Addr)
+			continue
+		}
+		msg := e.staleMessage()
+		switch {
+		case wantValue == nil && msg != nil:
+			t.Errorf("%s: stale message %v, want the last value held", e.Addr, msg.Arguments)
+		case wantValue != nil && (msg == nil || len(msg.Arguments) != 1 || msg.Arguments[0] != wantValue):
+			t.Errorf("%s: stale message %v, want %v", e.Addr, msg, wantValue)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/mdns"
+)
+
+// OSCQuery access values, see https://github.com/Vidvox/OSCQueryProposal
+const (
+	oscQueryAccessRead  = 1
+	oscQueryAccessWrite = 2
+)
+
+// oscAddress is an OSC address together with its OSC type tag.
+type oscAddress struct {
+	Addr   string
+	Type   string
+	Access int
+}
+
+// oscQueryNode is a node of the OSCQuery address tree.
+type oscQueryNode struct {
+	FullPath string                   `json:"FULL_PATH"`
+	Access   int                      `json:"ACCESS"`
+	Type     string                   `json:"TYPE,omitempty"`
+	Contents map[string]*oscQueryNode `json:"CONTENTS,omitempty"`
+}
+
+type oscQueryHostInfo struct {
+	Name         string          `json:"NAME"`
+	OSCIP        string          `json:"OSC_IP,omitempty"`
+	OSCPort      int             `json:"OSC_PORT,omitempty"`
+	OSCTransport string          `json:"OSC_TRANSPORT,omitempty"`
+	Extensions   map[string]bool `json:"EXTENSIONS"`
+}
+
+// buildOSCQueryTree arranges addresses into a tree rooted at "/".
+func buildOSCQueryTree(addrs []oscAddress) *oscQueryNode {
+	root := &oscQueryNode{FullPath: "/"}
+	for _, a := range addrs {
+		node := root
+		path := ""
+		for _, part := range strings.Split(strings.Trim(a.Addr, "/"), "/") {
+			path += "/" + part
+			if node.Contents == nil {
+				node.Contents = map[string]*oscQueryNode{}
+			}
+			child, ok := node.Contents[part]
+			if !ok {
+				child = &oscQueryNode{FullPath: path}
+				node.Contents[part] = child
+			}
+			node = child
+		}
+		node.Type = a.Type
+		node.Access = a.Access
+	}
+	return root
+}
+
+// findOSCQueryNode returns the node at path, or nil if there is none.
+func findOSCQueryNode(root *oscQueryNode, path string) *oscQueryNode {
+	node := root
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		node = node.Contents[part]
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// startOSCQuery serves the OSC addresses sent by o over OSCQuery, and advertises the service
+// over mDNS until ctx is cancelled. oscPort is the OSC port hds-osc receives controlAddr on (0 for none).
+func startOSCQuery(ctx context.Context, shutdown *sync.WaitGroup, o *oscExporter, port int, oscPort int, controlAddr string) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return fmt.Errorf("listening OSCQuery port: %v", err)
+	}
+	port = listener.Addr().(*net.TCPAddr).Port
+
+	hostInfo := oscQueryHostInfo{
+		Name:       "hds-osc",
+		Extensions: map[string]bool{"ACCESS": true, "VALUE": false},
+	}
+	if oscPort != 0 {
+		hostInfo.OSCIP = "127.0.0.1"
+		hostInfo.OSCPort = oscPort
+		hostInfo.OSCTransport = "UDP"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v any
+		if r.URL.Query().Has("HOST_INFO") {
+			v = hostInfo
+		} else {
+			addrs := o.addresses()
+			if oscPort != 0 {
+				addrs = append(addrs, oscAddress{Addr: controlAddr, Type: "T", Access: oscQueryAccessWrite})
+			}
+			node := findOSCQueryNode(buildOSCQueryTree(addrs), r.URL.Path)
+			if node == nil {
+				http.NotFound(w, r)
+				return
+			}
+			v = node
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			slog.Error("Serving OSCQuery", "err", err)
+		}
+	}))
+	server := &http.Server{Handler: mux}
+
+	instance := fmt.Sprintf("hds-osc-%d", os.Getpid())
+	mdnsServers, err := advertiseOSCQuery(instance, port, oscPort)
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		<-ctx.Done()
+		for _, s := range mdnsServers {
+			_ = s.Shutdown()
+		}
+		_ = server.Close()
+		slog.Info("OSCQuery server stopped")
+	}()
+	go func() {
+		slog.Info("OSCQuery server listening...", "port", port, "instance", instance)
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Serving OSCQuery", "err", err)
+		}
+	}()
+	return nil
+}
+
+// advertiseOSCQuery announces the OSCQuery HTTP service, and the OSC receive port if any, over mDNS.
+func advertiseOSCQuery(instance string, port, oscPort int) ([]*mdns.Server, error) {
+	services := map[string]int{"_oscjson._tcp": port}
+	if oscPort != 0 {
+		services["_osc._udp"] = oscPort
+	}
+
+	// Advertise interface addresses directly, as the host name may not resolve
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("listing interface addresses: %v", err)
+	}
+	var ips []net.IP
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	var servers []*mdns.Server
+	for service, p := range services {
+		zone, err := mdns.NewMDNSService(instance, service, "", "", p, ips, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating mDNS service %s: %v", service, err)
+		}
+		// The mdns package logs via the standard logger, which is too verbose
+		s, err := mdns.NewServer(&mdns.Config{Zone: zone, Logger: log.New(io.Discard, "", 0)})
+		if err != nil {
+			for _, s := range servers {
+				_ = s.Shutdown()
+			}
+			return nil, fmt.Errorf("starting mDNS server: %v", err)
+		}
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
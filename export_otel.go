@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+type otelExporter struct {
+	provider *sdkmetric.MeterProvider
+
+	data healthData
+	// Counter totals, kept increasing across source resets
+	stepTotal, distanceTotal, calorieTotal monotonicCounter
+	dataLock                               sync.RWMutex
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "otel",
+		description: "OpenTelemetry metrics pushed over OTLP HTTP",
+		flags:       []string{"otel-enabled", "otel-endpoint", "otel-interval"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			interval, err := cfg.Duration("interval")
+			if err != nil {
+				return nil, err
+			}
+			slog.Info("OTel enabled", "endpoint", cfg.String("endpoint"), "interval", interval)
+			return newOTelExporter(env.ctx, env.shutdown, cfg.String("endpoint"), interval)
+		},
+	})
+}
+
+// newOTelExporter creates an exporter pushing every interval until ctx is cancelled, when the
+// last interval is flushed before shutdown completes.
+func newOTelExporter(ctx context.Context, shutdown *sync.WaitGroup, endpoint string, interval time.Duration) (*otelExporter, error) {
+	exp, err := otlpmetrichttp.New(context.Background(), otlpmetrichttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %v", err)
+	}
+
+	e := &otelExporter{}
+	e.provider = sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp, sdkmetric.WithInterval(interval))),
+		sdkmetric.WithResource(resource.NewSchemaless(attribute.String("service.name", "hds-osc"))),
+	)
+	meter := e.provider.Meter("github.com/motoki317/hds-osc")
+
+	// Same gauge/counter split as the Prometheus exporter
+	heartRate, err := meter.Float64ObservableGauge("heart_rate",
+		metric.WithDescription("Current heart rate in beats per minute"), metric.WithUnit("{beat}/min"))
+	if err != nil {
+		return nil, err
+	}
+	stepCount, err := meter.Int64ObservableCounter("step_count",
+		metric.WithDescription("Total step count, accumulated across source resets"), metric.WithUnit("{step}"))
+	if err != nil {
+		return nil, err
+	}
+	distanceTraveled, err := meter.Float64ObservableCounter("distance_traveled",
+		metric.WithDescription("Total distance traveled in meters, accumulated across source resets"), metric.WithUnit("m"))
+	if err != nil {
+		return nil, err
+	}
+	speed, err := meter.Float64ObservableGauge("speed",
+		metric.WithDescription("Current speed in meters per second"), metric.WithUnit("m/s"))
+	if err != nil {
+		return nil, err
+	}
+	calories, err := meter.Int64ObservableCounter("calories",
+		metric.WithDescription("Total calories burned, accumulated across source resets"), metric.WithUnit("kcal"))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		e.dataLock.RLock()
+		data := e.data
+		steps, distance, cals := e.stepTotal.Total(), e.distanceTotal.Total(), e.calorieTotal.Total()
+		e.dataLock.RUnlock()
+
+		// Do not report anything while data is absent or stale, same as Prometheus
+		if isStale(data.Time) {
+			return nil
+		}
+		o.ObserveFloat64(heartRate, data.HeartRateValue())
+		o.ObserveInt64(stepCount, int64(steps))
+		o.ObserveFloat64(distanceTraveled, distance)
+		o.ObserveFloat64(speed, data.Speed)
+		o.ObserveInt64(calories, int64(cals))
+		return nil
+	}, heartRate, stepCount, distanceTraveled, speed, calories)
+	if err != nil {
+		return nil, fmt.Errorf("registering OTel callback: %v", err)
+	}
+
+	registerReset("otel", e.resetCounters)
+	slog.Info("OTel exporter pushing...", "endpoint", endpoint, "interval", interval)
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		<-ctx.Done()
+		// ctx is already done, so bound the final push separately
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := e.provider.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Shutting down OTel meter provider", "err", err)
+		}
+	}()
+	return e, nil
+}
+
+// resetCounters resets the counter bases if counters is set, returning the totals before.
+func (e *otelExporter) resetCounters(counters bool) any {
+	if !counters {
+		return nil
+	}
+	e.dataLock.Lock()
+	defer e.dataLock.Unlock()
+	return resetCounterBases(&e.stepTotal, &e.distanceTotal, &e.calorieTotal)
+}
+
+func (e *otelExporter) Update(data healthData, _ string) error {
+	e.dataLock.Lock()
+	e.data = data
+	e.stepTotal.Update(float64(data.StepCount))
+	e.distanceTotal.Update(data.DistanceTraveled)
+	e.calorieTotal.Update(float64(data.Calories))
+	e.dataLock.Unlock()
+	return nil
+}
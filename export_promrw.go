@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/motoki317/hds-osc/prompb"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// promRemoteWriteExporter periodically pushes the same metrics as the Prometheus
+// scrape endpoint to a remote-write receiver.
+type promRemoteWriteExporter struct {
+	metrics *prometheusExporter
+	client  *http.Client
+
+	url      string
+	authUser string
+	authPass string
+
+	// Pushes happen on their own interval, so health is tracked there rather than from Update
+	healthTracker
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "prom-remote-write",
+		description: "Prometheus remote-write pushes of the metrics",
+		flags:       []string{"prom-remote-write-url", "prom-remote-write-interval", "prom-remote-write-user", "prom-remote-write-pass", "prom-namespace", "prom-go-metrics", "prom-staleness-key"},
+		enabled:     func(cfg exporterConfig) bool { return cfg.String("url") != "" },
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			interval, err := cfg.Duration("interval")
+			if err != nil {
+				return nil, err
+			}
+			if err := validateStalenessKey(cfg.String("prom-staleness-key")); err != nil {
+				return nil, err
+			}
+			slog.Info("Prometheus remote-write enabled", "url", cfg.String("url"), "interval", interval)
+			return newPromRemoteWriteExporter(env.ctx, env.shutdown, cfg.String("url"), cfg.String("prom-namespace"), cfg.Bool("prom-go-metrics"), cfg.String("prom-staleness-key"), cfg.String("user"), cfg.String("pass"), interval), nil
+		},
+	})
+}
+
+// newPromRemoteWriteExporter creates an exporter pushing every interval until ctx is cancelled.
+func newPromRemoteWriteExporter(ctx context.Context, shutdown *sync.WaitGroup, url, namespace string, goMetrics bool, stalenessKey, authUser, authPass string, interval time.Duration) *promRemoteWriteExporter {
+	p := &promRemoteWriteExporter{
+		metrics:  newPrometheusMetrics(namespace, goMetrics, stalenessKey),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		url:      url,
+		authUser: authUser,
+		authPass: authPass,
+	}
+	registerReset("promRemoteWrite", p.metrics.resetCounters)
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := p.push()
+			if err != nil {
+				slog.Error("Pushing prometheus remote-write", "err", err)
+			}
+			p.record(err)
+		}
+	}()
+	return p
+}
+
+func (p *promRemoteWriteExporter) Update(data healthData, updatedKey string) error {
+	return p.metrics.Update(data, updatedKey)
+}
+
+func (p *promRemoteWriteExporter) push() error {
+	// Push nothing while data is absent or stale, whereas the scrape endpoint still serves the ungated metrics
+	if p.metrics.stale() {
+		return nil
+	}
+
+	families, err := p.metrics.gatherers().Gather()
+	if err != nil {
+		return fmt.Errorf("gathering metrics: %v", err)
+	}
+	b, err := proto.Marshal(toWriteRequest(families, time.Now()))
+	if err != nil {
+		return fmt.Errorf("encoding write request: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(snappy.Encode(nil, b)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if p.authUser != "" {
+		req.SetBasicAuth(p.authUser, p.authPass)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting write request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote-write returned %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// toWriteRequest converts gathered gauges and counters into one sample per series at t.
+func toWriteRequest(families []*dto.MetricFamily, t time.Time) *prompb.WriteRequest {
+	req := &prompb.WriteRequest{}
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			var value float64
+			switch {
+			case m.GetGauge() != nil:
+				value = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				value = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+
+			labels := []*prompb.Label{{Name: "__name__", Value: mf.GetName()}}
+			for _, l := range m.GetLabel() {
+				labels = append(labels, &prompb.Label{Name: l.GetName(), Value: l.GetValue()})
+			}
+			slices.SortFunc(labels, func(a, b *prompb.Label) int {
+				return strings.Compare(a.Name, b.Name)
+			})
+			req.Timeseries = append(req.Timeseries, &prompb.TimeSeries{
+				Labels:  labels,
+				Samples: []*prompb.Sample{{Value: value, Timestamp: t.UnixMilli()}},
+			})
+		}
+	}
+	return req
+}
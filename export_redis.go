@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisExporter struct {
+	client  *redis.Client
+	channel string
+	key     string
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "redis",
+		description: "Redis publisher of update messages, optionally storing the latest data",
+		flags:       []string{"redis-enabled", "redis-addr", "redis-channel", "redis-key"},
+		create: func(_ *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("Redis enabled", "addr", cfg.String("addr"), "channel", cfg.String("channel"))
+			return newRedisExporter(cfg.String("addr"), cfg.String("channel"), cfg.String("key")), nil
+		},
+	})
+}
+
+func newRedisExporter(addr, channel, key string) *redisExporter {
+	// The client keeps a connection pool and redials broken connections by itself
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	slog.Info("Redis exporter configured", "addr", addr, "channel", channel, "key", key)
+	return &redisExporter{
+		client:  client,
+		channel: channel,
+		key:     key,
+	}
+}
+
+func (r *redisExporter) Update(data healthData, updatedKey string) error {
+	ctx := context.Background()
+
+	msg := wsUpdateMessage{Data: data, UpdatedKey: updatedKey}
+	b, err := json.Marshal(&msg)
+	if err != nil {
+		return fmt.Errorf("encoding Redis message: %v", err)
+	}
+	if err = r.client.Publish(ctx, r.channel, b).Err(); err != nil {
+		return fmt.Errorf("publishing to Redis: %v", err)
+	}
+
+	// Let the latest key expire on disconnect, instead of refreshing it with stale data
+	if r.key == "" || updatedKey == disconnectedKey {
+		return nil
+	}
+	b, err = json.Marshal(&data)
+	if err != nil {
+		return fmt.Errorf("encoding Redis value: %v", err)
+	}
+	// Let the key expire by itself once data goes stale
+	if err = r.client.Set(ctx, r.key, b, dataStaleAfter).Err(); err != nil {
+		return fmt.Errorf("setting Redis key: %v", err)
+	}
+	return nil
+}
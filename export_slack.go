@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type slackExporter struct {
+	client     *http.Client
+	webhookURL string
+
+	// alert mode
+	alerter *hrThresholdAlerter
+
+	// summary mode accumulators, reset after each post
+	summaryLock sync.Mutex
+	hrCount     int
+	hrSum       int
+	hrMin       int
+	hrMax       int
+
+	// Summaries are posted on their own interval, so health is tracked here rather than from Update
+	healthTracker
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "slack",
+		description: "Slack incoming webhook heart rate alerts or summaries",
+		flags:       []string{"slack-enabled", "slack-webhook-url", "slack-mode", "slack-summary-interval", "alert-hr-high", "alert-hr-low", "alert-hr-hysteresis"},
+		keys:        []string{"heartRate"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("Slack enabled", "mode", cfg.String("mode"))
+			if cfg.String("mode") == "summary" {
+				interval, err := cfg.Duration("summary-interval")
+				if err != nil {
+					return nil, err
+				}
+				return newSlackSummaryExporter(env.ctx, env.shutdown, cfg.String("webhook-url"), interval), nil
+			}
+			alerter := newHRThresholdAlerter(cfg.Float64("alert-hr-high"), cfg.Float64("alert-hr-low"), cfg.Float64("alert-hr-hysteresis"))
+			env.alerters = append(env.alerters, alerter)
+			return newSlackAlertExporter(cfg.String("webhook-url"), alerter), nil
+		},
+	})
+}
+
+func newSlackAlertExporter(webhookURL string, alerter *hrThresholdAlerter) *slackExporter {
+	return &slackExporter{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		webhookURL: webhookURL,
+		alerter:    alerter,
+	}
+}
+
+// newSlackSummaryExporter creates an exporter posting a summary every interval until ctx is cancelled.
+func newSlackSummaryExporter(ctx context.Context, shutdown *sync.WaitGroup, webhookURL string, interval time.Duration) *slackExporter {
+	s := &slackExporter{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		webhookURL: webhookURL,
+	}
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			posted, err := s.postSummary(interval)
+			if err != nil {
+				slog.Error("Posting slack summary", "err", err)
+			}
+			if posted {
+				s.record(err)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *slackExporter) Update(data healthData, _ string) error {
+	if s.alerter != nil {
+		event := s.alerter.Check(data.HeartRateValue())
+		if event == hrAlertNone {
+			return nil
+		}
+		err := s.send(formatHRAlert(event, data))
+		s.record(err)
+		return err
+	}
+
+	s.summaryLock.Lock()
+	defer s.summaryLock.Unlock()
+	if s.hrCount == 0 {
+		s.hrMin, s.hrMax = data.HeartRate, data.HeartRate
+	}
+	s.hrCount++
+	s.hrSum += data.HeartRate
+	s.hrMin = min(s.hrMin, data.HeartRate)
+	s.hrMax = max(s.hrMax, data.HeartRate)
+	return nil
+}
+
+// postSummary posts the heart rate since the last summary, reporting whether there was any to post.
+func (s *slackExporter) postSummary(interval time.Duration) (posted bool, err error) {
+	s.summaryLock.Lock()
+	count, sum, hrMin, hrMax := s.hrCount, s.hrSum, s.hrMin, s.hrMax
+	s.hrCount, s.hrSum, s.hrMin, s.hrMax = 0, 0, 0, 0
+	s.summaryLock.Unlock()
+
+	if count == 0 {
+		return false, nil
+	}
+	avg := float64(sum) / float64(count)
+	return true, s.send(fmt.Sprintf("Heart rate over the last %s: min %d / avg %.1f / max %d BPM", interval, hrMin, avg, hrMax))
+}
+
+type slackWebhookRequest struct {
+	Text string `json:"text"`
+}
+
+func (s *slackExporter) send(text string) error {
+	b, err := json.Marshal(&slackWebhookRequest{Text: text})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.webhookURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("posting to slack webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return fmt.Errorf("posting to slack webhook: unexpected status %d", resp.StatusCode)
+	}
+	slog.Info("Posted slack message", "text", text)
+	return nil
+}
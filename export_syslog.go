@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// syslogPriority is facility local0 (16) with severity informational (6)
+	syslogPriority = 16*8 + 6
+	// syslogSDID identifies our structured data element; 32473 is the documentation enterprise number
+	syslogSDID = "hds@32473"
+	// syslogTimeLayout has the microsecond precision at most allowed by the RFC5424 TIMESTAMP
+	syslogTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+type syslogExporter struct {
+	network  string
+	addr     string
+	hostname string
+
+	conn     net.Conn
+	connLock sync.Mutex
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "syslog",
+		description: "RFC5424 syslog messages",
+		flags:       []string{"syslog-enabled", "syslog-network", "syslog-addr"},
+		create: func(_ *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("Syslog enabled", "network", cfg.String("network"), "addr", cfg.String("addr"))
+			return newSyslogExporter(cfg.String("network"), cfg.String("addr")), nil
+		},
+	})
+}
+
+func newSyslogExporter(network, addr string) *syslogExporter {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	slog.Info("Syslog exporter configured", "network", network, "addr", addr)
+	return &syslogExporter{
+		network:  network,
+		addr:     addr,
+		hostname: hostname,
+	}
+}
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// format builds an RFC5424 message carrying all fields as structured data.
+func (s *syslogExporter) format(data healthData, updatedKey string) string {
+	var sd strings.Builder
+	sd.WriteString("[" + syslogSDID)
+	sd.WriteString(` updatedKey="` + syslogParamEscaper.Replace(updatedKey) + `"`)
+	for _, key := range healthDataKeys {
+		value, _ := data.Get(key)
+		sd.WriteString(" " + key + `="` + strconv.FormatFloat(value, 'f', -1, 64) + `"`)
+	}
+	sd.WriteString("]")
+
+	ts := data.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return fmt.Sprintf("<%d>1 %s %s hds-osc %d update %s %s updated",
+		syslogPriority, ts.Format(syslogTimeLayout), s.hostname, os.Getpid(), sd.String(), updatedKey)
+}
+
+func (s *syslogExporter) write(msg string) error {
+	if s.conn == nil {
+		conn, err := net.Dial(s.network, s.addr)
+		if err != nil {
+			return fmt.Errorf("dialing syslog server: %v", err)
+		}
+		s.conn = conn
+	}
+
+	frame := msg
+	if s.network != "udp" {
+		// Octet-counting framing for stream transports (RFC6587)
+		frame = strconv.Itoa(len(msg)) + " " + msg
+	}
+	if _, err := s.conn.Write([]byte(frame)); err != nil {
+		// Drop the connection so that the next write redials
+		_ = s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("writing syslog message: %v", err)
+	}
+	return nil
+}
+
+func (s *syslogExporter) Update(data healthData, updatedKey string) error {
+	msg := s.format(data, updatedKey)
+
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	err := s.write(msg)
+	if err != nil && s.network != "udp" {
+		// Retry once on a fresh connection, in case the server restarted
+		slog.Warn("Reconnecting to syslog server", "err", err)
+		err = s.write(msg)
+	}
+	return err
+}
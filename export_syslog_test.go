@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogFormatHeader(t *testing.T) {
+	s := &syslogExporter{hostname: "host"}
+	tests := []struct {
+		time time.Time
+		want string
+	}{
+		{time.Date(2024, 5, 1, 12, 30, 45, 123456789, time.UTC), "2024-05-01T12:30:45.123456Z"},
+		{time.Date(2024, 5, 1, 12, 30, 45, 0, time.FixedZone("", 9*60*60)), "2024-05-01T12:30:45.000000+09:00"},
+	}
+	// TIMESTAMP with TIME-SECFRAC of 1 to 6 digits, as RFC5424 requires
+	timestamp := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,6})?(Z|[+-]\d{2}:\d{2})$`)
+	for _, tt := range tests {
+		var data healthData
+		data.Update("heartRate", 80)
+		data.Time = tt.time
+
+		msg := s.format(data, "heartRate")
+		wantPrefix := fmt.Sprintf("<134>1 %s host hds-osc %d update [hds@32473 ", tt.want, os.Getpid())
+		if !strings.HasPrefix(msg, wantPrefix) {
+			t.Errorf("format() = %q, want prefix %q", msg, wantPrefix)
+		}
+		if !timestamp.MatchString(tt.time.Format(syslogTimeLayout)) {
+			t.Errorf("timestamp %q is not a valid RFC5424 TIMESTAMP", tt.time.Format(syslogTimeLayout))
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type telegramExporter struct {
+	client  *http.Client
+	token   string
+	chatID  string
+	alerter *hrThresholdAlerter
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "telegram",
+		description: "Telegram heart rate alerts",
+		flags:       []string{"telegram-enabled", "telegram-token", "telegram-chat-id", "alert-hr-high", "alert-hr-low", "alert-hr-hysteresis"},
+		keys:        []string{"heartRate"},
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("Telegram enabled", "chatID", cfg.String("chat-id"), "high", cfg.Float64("alert-hr-high"), "low", cfg.Float64("alert-hr-low"))
+			alerter := newHRThresholdAlerter(cfg.Float64("alert-hr-high"), cfg.Float64("alert-hr-low"), cfg.Float64("alert-hr-hysteresis"))
+			env.alerters = append(env.alerters, alerter)
+			return newTelegramExporter(cfg.String("token"), cfg.String("chat-id"), alerter), nil
+		},
+	})
+}
+
+func newTelegramExporter(token, chatID string, alerter *hrThresholdAlerter) *telegramExporter {
+	return &telegramExporter{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		token:   token,
+		chatID:  chatID,
+		alerter: alerter,
+	}
+}
+
+type telegramSendMessageRequest struct {
+	ChatID string `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+func (t *telegramExporter) Update(data healthData, _ string) error {
+	event := t.alerter.Check(data.HeartRateValue())
+	if event == hrAlertNone {
+		return nil
+	}
+	return t.send(formatHRAlert(event, data))
+}
+
+func (t *telegramExporter) send(text string) error {
+	b, err := json.Marshal(&telegramSendMessageRequest{ChatID: t.chatID, Text: text})
+	if err != nil {
+		return err
+	}
+	url := "https://api.telegram.org/bot" + t.token + "/sendMessage"
+	resp, err := t.client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		// Do not leak the token embedded in the URL
+		return fmt.Errorf("sending telegram message: request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || 300 <= resp.StatusCode {
+		return fmt.Errorf("sending telegram message: unexpected status %d", resp.StatusCode)
+	}
+	slog.Info("Sent telegram alert", "text", text)
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWSServerDropsClientNotReading(t *testing.T) {
+	h := &httpServerExporter{hub: newBroadcaster(), defaultEncoding: wsEncodingJSON}
+	defer func(timeout time.Duration) {
+		// Restored once the handlers writing with it returned
+		waitFor(t, "clients to disconnect", func() bool { return h.hub.Clients() == 0 })
+		wsWriteTimeout = timeout
+	}(wsWriteTimeout)
+	wsWriteTimeout = 200 * time.Millisecond
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(h.connectWS))
+	// Small socket buffers, so that writes to the client not reading block soon
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if tcp, ok := conn.(*net.TCPConn); ok && state == http.StateNew {
+			_ = tcp.SetWriteBuffer(4096)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			_ = tcp.SetReadBuffer(4096)
+		}
+		return conn, err
+	}}
+	stalled, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	reading, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reading.Close()
+
+	var received atomic.Int64
+	go func() {
+		for {
+			if _, _, err := reading.ReadMessage(); err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	}()
+	waitFor(t, "both clients subscribed", func() bool { return h.hub.Clients() == 2 })
+
+	var data healthData
+	deadline := time.Now().Add(10 * time.Second)
+	for h.hub.Clients() == 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("client not reading was not dropped")
+		}
+		data.Update("heartRate", 80)
+		_ = h.hub.Update(data, "heartRate")
+		time.Sleep(100 * time.Microsecond)
+	}
+
+	// The other client still receives updates
+	before := received.Load()
+	waitFor(t, "update received by the reading client", func() bool {
+		_ = h.hub.Update(data, "heartRate")
+		return received.Load() > before
+	})
+}
+
+func TestPrometheusServesPipelineCountersWhileStale(t *testing.T) {
+	e := newPrometheusMetrics("hds", false, "any")
+	countDropped(dropStageThrottle)
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	// No data yet
+	body := scrape()
+	for _, name := range []string{"hds_dropped_updates_total", "hds_received_updates_total"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("%s not served without data", name)
+		}
+	}
+	if strings.Contains(body, "hds_heart_rate") {
+		t.Error("hds_heart_rate served without data")
+	}
+
+	var data healthData
+	data.Update("heartRate", 80)
+	_ = e.Update(data, "heartRate")
+	body = scrape()
+	if !strings.Contains(body, "hds_heart_rate 80") || !strings.Contains(body, "hds_dropped_updates_total") {
+		t.Errorf("fresh data: want both health and pipeline metrics, got\n%s", body)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+)
+
+// unixSocketExporter serves data received by hub to local processes over a Unix domain socket.
+// Each connection first receives the latest data, then a stream of updates,
+// all as newline-delimited wsUpdateMessage JSON.
+type unixSocketExporter struct {
+	listener net.Listener
+	hub      *broadcaster
+}
+
+func init() {
+	registerExporter(exporterRegistration{
+		name:        "unix-socket",
+		description: "Unix socket streaming update messages to local processes",
+		flags:       []string{"unix-socket"},
+		enabled:     func(cfg exporterConfig) bool { return cfg.String("unix-socket") != "" },
+		create: func(env *exporterEnv, cfg exporterConfig) (exporter, error) {
+			slog.Info("Unix socket enabled", "path", cfg.String("unix-socket"))
+			// Streams from the shared broadcaster
+			_, err := newUnixSocketExporter(env.ctx, env.shutdown, env.broadcaster(), cfg.String("unix-socket"))
+			return nil, err
+		},
+	})
+}
+
+func newUnixSocketExporter(ctx context.Context, shutdown *sync.WaitGroup, hub *broadcaster, path string) (*unixSocketExporter, error) {
+	// Remove a socket file left over by an unclean exit
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("removing stale unix socket: %v", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listening unix socket: %v", err)
+	}
+
+	u := &unixSocketExporter{listener: listener, hub: hub}
+	shutdown.Add(1)
+	go func() {
+		defer shutdown.Done()
+		<-ctx.Done()
+		// Closing the listener also removes the socket file
+		_ = listener.Close()
+		slog.Info("Unix socket exporter stopped", "path", path)
+	}()
+	go u.serve()
+
+	slog.Info("Unix socket exporter listening...", "path", path)
+	return u, nil
+}
+
+func (u *unixSocketExporter) serve() {
+	for {
+		conn, err := u.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Error("Accepting unix socket connection", "err", err)
+			continue
+		}
+		go u.handle(conn)
+	}
+}
+
+func (u *unixSocketExporter) handle(conn net.Conn) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, _, unsubscribe := u.hub.Subscribe(ctx, 16)
+	defer unsubscribe()
+
+	// Detect the client going away, as it never sends anything
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		buf := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	enc := json.NewEncoder(conn)
+	data := u.hub.Latest()
+	if !data.Time.IsZero() {
+		if err := enc.Encode(&wsUpdateMessage{Data: data, UpdatedKey: "all"}); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-closed:
+			return
+		case msg := <-ch:
+			if err := enc.Encode(msg); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hrJumpFilter rejects isolated heart rate samples that jump more than maxJump BPM
+// from the last accepted value. A jump is accepted once the next sample confirms it.
+type hrJumpFilter struct {
+	next    []exporter
+	maxJump int
+
+	lock        sync.Mutex
+	hasAccepted bool
+	accepted    float64
+	hasPending  bool
+	pending     float64
+}
+
+func newHRJumpFilter(next []exporter, maxJump int) *hrJumpFilter {
+	return &hrJumpFilter{
+		next:    next,
+		maxJump: maxJump,
+	}
+}
+
+func (f *hrJumpFilter) accept(hr float64) bool {
+	maxJump := float64(f.maxJump)
+	switch {
+	case !f.hasAccepted, math.Abs(hr-f.accepted) <= maxJump:
+	case f.hasPending && math.Abs(hr-f.pending) <= maxJump:
+		// The previously rejected jump persisted, so it is real
+	default:
+		f.hasPending, f.pending = true, hr
+		return false
+	}
+	f.hasAccepted, f.accepted = true, hr
+	f.hasPending = false
+	return true
+}
+
+func (f *hrJumpFilter) Update(data healthData, updatedKey string) error {
+	f.lock.Lock()
+	if updatedKey == "heartRate" || updatedKey == "all" {
+		if !f.accept(data.HeartRateValue()) {
+			slog.Debug("Rejected heart rate sample", "hr", data.HeartRateValue(), "last", f.accepted, "maxJump", f.maxJump)
+			if updatedKey == "heartRate" {
+				f.lock.Unlock()
+				return nil
+			}
+		}
+	}
+	// Other fields still pass through, with the last accepted heart rate
+	if f.hasAccepted {
+		data.setHeartRate(f.accepted)
+	}
+	f.lock.Unlock()
+
+	sendToExporters(f.next, data, updatedKey)
+	return nil
+}
+
+// allFailDetector sends updates to the exporters, and marks the process as not ready
+// after threshold consecutive updates where every exporter failed. It is ready again
+// as soon as any exporter succeeds.
+type allFailDetector struct {
+	exporters []exporter
+	threshold int
+
+	lock     sync.Mutex
+	failures int
+}
+
+func newAllFailDetector(exporters []exporter, threshold int) *allFailDetector {
+	return &allFailDetector{
+		exporters: exporters,
+		threshold: threshold,
+	}
+}
+
+func (d *allFailDetector) Update(data healthData, updatedKey string) error {
+	failed := sendToExporters(d.exporters, data, updatedKey)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if failed < len(d.exporters) {
+		if d.failures >= d.threshold {
+			slog.Info("Exporters recovered", "afterFailures", d.failures)
+			setNotReady("exporters", "")
+		}
+		d.failures = 0
+		return nil
+	}
+	d.failures++
+	if d.failures == d.threshold {
+		slog.Warn("All exporters are failing, no data is being delivered", "consecutiveUpdates", d.failures)
+		setNotReady("exporters", "all exporters failing")
+	}
+	return nil
+}
+
+// updateRateLimiter passes at most rate updates per second on, with bursts of up to one
+// second's worth. Excess updates are dropped, except for the most recent one, which is
+// passed on once the rate allows.
+type updateRateLimiter struct {
+	next  []exporter
+	rate  float64
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+	// pending is the most recent held back update, sent by timer
+	pending    *wsUpdateMessage
+	timer      *time.Timer
+	timerArmed bool
+}
+
+func newUpdateRateLimiter(next []exporter, rate float64) *updateRateLimiter {
+	l := &updateRateLimiter{
+		next:   next,
+		rate:   rate,
+		burst:  max(rate, 1),
+		tokens: max(rate, 1),
+	}
+	l.timer = time.AfterFunc(time.Hour, l.sendPending)
+	l.timer.Stop()
+	return l
+}
+
+// refill adds the tokens accrued since the last call. Must be called with lock held.
+func (l *updateRateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.burst)
+	}
+	l.last = now
+}
+
+func (l *updateRateLimiter) Update(data healthData, updatedKey string) error {
+	l.lock.Lock()
+	l.refill(time.Now())
+	if l.pending == nil && l.tokens >= 1 {
+		l.tokens--
+		l.lock.Unlock()
+		sendToExporters(l.next, data, updatedKey)
+		return nil
+	}
+
+	if l.pending != nil {
+		countDropped(dropStageRateLimit)
+		// The data includes the previous update, but exporters filtering by key need to see both
+		if l.pending.UpdatedKey != updatedKey {
+			updatedKey = "all"
+		}
+	}
+	l.pending = &wsUpdateMessage{Data: data, UpdatedKey: updatedKey}
+	if !l.timerArmed {
+		l.timerArmed = true
+		l.timer.Reset(time.Duration((1 - l.tokens) / l.rate * float64(time.Second)))
+	}
+	l.lock.Unlock()
+	return nil
+}
+
+func (l *updateRateLimiter) sendPending() {
+	l.lock.Lock()
+	l.timerArmed = false
+	l.refill(time.Now())
+	msg := l.pending
+	l.pending = nil
+	l.tokens = max(l.tokens-1, 0)
+	l.lock.Unlock()
+
+	if msg != nil {
+		sendToExporters(l.next, msg.Data, msg.UpdatedKey)
+	}
+}
+
+// cumulativeKeys are the fields counting up over a session, which the source resets to a lower value.
+var cumulativeKeys = []string{"stepCount", "distanceTraveled", "calories"}
+
+// rateGuard rejects field updates changing faster than the field's maximum per second since
+// its last accepted value, e.g. distance glitching kilometers ahead. Decreases of cumulative
+// fields are source resets and accepted, as are values after the field went stale. Updates of
+// other fields pass through with the last accepted values.
+type rateGuard struct {
+	next     []exporter
+	maxRates map[string]float64
+
+	lock sync.Mutex
+	// accepted holds the last accepted value and update time of each guarded field
+	accepted healthData
+}
+
+func newRateGuard(next []exporter, maxRates map[string]float64) *rateGuard {
+	return &rateGuard{next: next, maxRates: maxRates}
+}
+
+// parseMaxRates parses "distanceTraveled=50,speed=10" style maximum changes per second.
+func parseMaxRates(s string) (map[string]float64, error) {
+	m := make(map[string]float64)
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		key, rateStr, ok := strings.Cut(pair, "=")
+		if !ok || !slices.Contains(healthDataKeys, key) {
+			return nil, fmt.Errorf("invalid rate of change %q, expected field=max", pair)
+		}
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("%s: max rate of change must be a positive number, got %q", key, rateStr)
+		}
+		m[key] = rate
+	}
+	return m, nil
+}
+
+// accept reports whether the value of key in data is within its maximum rate of change, and if
+// so records it as accepted.
+func (g *rateGuard) accept(data healthData, key string) bool {
+	maxRate, ok := g.maxRates[key]
+	if !ok {
+		return true
+	}
+	t := data.KeyTimes.Get(key)
+	lastTime := g.accepted.KeyTimes.Get(key)
+	value, _ := data.Get(key)
+	last, _ := g.accepted.Get(key)
+	change := value - last
+	switch {
+	case lastTime.IsZero(), t.Sub(lastTime) > dataStaleAfter, change < 0 && slices.Contains(cumulativeKeys, key):
+	case math.Abs(change) > maxRate*t.Sub(lastTime).Seconds():
+		slog.Warn("Rejected update exceeding max rate of change", "key", key, "value", value, "last", last,
+			"elapsed", t.Sub(lastTime), "maxPerSecond", maxRate)
+		rateGuardRejected.Inc(key)
+		countDropped(dropStageRateGuard)
+		return false
+	}
+	g.accepted.copyField(data, key)
+	return true
+}
+
+func (g *rateGuard) Update(data healthData, updatedKey string) error {
+	g.lock.Lock()
+	if updatedKey != "all" && !g.accept(data, updatedKey) {
+		g.lock.Unlock()
+		return nil
+	}
+	// The other fields carry the last accepted values, as receivers keep the rejected ones
+	for key := range g.maxRates {
+		if key == updatedKey || (updatedKey == "all" && !data.KeyTimes.Get(key).IsZero() && g.accept(data, key)) {
+			continue
+		}
+		if !g.accepted.KeyTimes.Get(key).IsZero() {
+			data.copyField(g.accepted, key)
+		}
+	}
+	g.lock.Unlock()
+
+	sendToExporters(g.next, data, updatedKey)
+	return nil
+}
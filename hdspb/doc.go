@@ -0,0 +1,4 @@
+// Package hdspb contains the generated gRPC API for hds-osc.
+package hdspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative hds.proto
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// exporterHealth summarizes the recent deliveries of an exporter, for GET /stats.
+type exporterHealth struct {
+	Type                string     `json:"type"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorTime       *time.Time `json:"lastErrorTime,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+// healthReporter is implemented by exporters tracking their own health, e.g. those delivering
+// from a goroutine, where the errors returned by Update do not cover delivery failures.
+type healthReporter interface {
+	Health() exporterHealth
+}
+
+// healthTracker records delivery results into an exporterHealth.
+type healthTracker struct {
+	lock   sync.Mutex
+	health exporterHealth
+}
+
+// record notes the result of a delivery.
+func (t *healthTracker) record(err error) {
+	now := time.Now()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err != nil {
+		t.health.LastError, t.health.LastErrorTime = err.Error(), &now
+		t.health.ConsecutiveFailures++
+		return
+	}
+	t.health.LastSuccess = &now
+	t.health.ConsecutiveFailures = 0
+}
+
+func (t *healthTracker) Health() exporterHealth {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.health
+}
+
+// monitoredExporter tracks the health of an exporter from its Update results,
+// unless the exporter reports its own health.
+type monitoredExporter struct {
+	name string
+	next exporter
+	// keys filters the updates sent to next, see exporterRegistration.keys
+	keys []string
+	healthTracker
+}
+
+func (m *monitoredExporter) Update(data healthData, updatedKey string) error {
+	if updatedKey != "all" && !slices.Contains(m.keys, "*") && !slices.Contains(m.keys, updatedKey) {
+		return nil
+	}
+	err := m.next.Update(data, updatedKey)
+	m.record(err)
+	return err
+}
+
+func (m *monitoredExporter) Health() exporterHealth {
+	var h exporterHealth
+	if r, ok := m.next.(healthReporter); ok {
+		h = r.Health()
+	} else {
+		h = m.healthTracker.Health()
+	}
+	h.Type = m.name
+	return h
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// hrvWindow is the number of recent update intervals the HRV estimate is computed over.
+const hrvWindow = 30
+
+// hrvEstimator sets healthData.HRVEstimate to the RMSSD of the intervals between
+// heart rate updates, in milliseconds. Sources report BPM rather than R-R intervals,
+// so this only approximates heart rate variability for sources sending about once per beat.
+// The estimate resets when data goes stale.
+type hrvEstimator struct {
+	next []exporter
+
+	lock      sync.Mutex
+	lastTime  time.Time
+	intervals []float64
+	estimate  float64
+}
+
+func newHRVEstimator(next []exporter) *hrvEstimator {
+	return &hrvEstimator{next: next}
+}
+
+func (h *hrvEstimator) reset() {
+	h.lastTime = time.Time{}
+	h.intervals = h.intervals[:0]
+	h.estimate = 0
+}
+
+func (h *hrvEstimator) add(t time.Time) {
+	if !h.lastTime.IsZero() && t.Sub(h.lastTime) > dataStaleAfter {
+		h.reset()
+	}
+	if !h.lastTime.IsZero() && t.After(h.lastTime) {
+		h.intervals = append(h.intervals, float64(t.Sub(h.lastTime).Milliseconds()))
+		if len(h.intervals) > hrvWindow {
+			h.intervals = h.intervals[1:]
+		}
+	}
+	h.lastTime = t
+
+	if len(h.intervals) < 2 {
+		h.estimate = 0
+		return
+	}
+	var sum float64
+	for i := 1; i < len(h.intervals); i++ {
+		diff := h.intervals[i] - h.intervals[i-1]
+		sum += diff * diff
+	}
+	h.estimate = math.Sqrt(sum / float64(len(h.intervals)-1))
+}
+
+func (h *hrvEstimator) Update(data healthData, updatedKey string) error {
+	h.lock.Lock()
+	switch updatedKey {
+	case disconnectedKey:
+		h.reset()
+	case "heartRate":
+		h.add(data.KeyTimes.HeartRate)
+	}
+	data.HRVEstimate = h.estimate
+	h.lock.Unlock()
+
+	sendToExporters(h.next, data, updatedKey)
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// jsonFieldMap renames healthData keys in the JSON output. Set from the -json-field-map flag.
+var jsonFieldMap = map[string]string{}
+
+// parseJSONFieldMap parses "heartRate=hr,stepCount=steps" style mappings.
+func parseJSONFieldMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || to == "" {
+			return nil, fmt.Errorf("invalid field mapping %q", pair)
+		}
+		if !lo.Contains([]string{"time", "hrvEstimate", "heartRateWindow", "keyTimes", "speedKmh", "speedMph", "sessionDuration", "units"}, from) && !lo.Contains(healthDataKeys, from) {
+			return nil, fmt.Errorf("unknown field %q", from)
+		}
+		m[from] = to
+	}
+	return m, nil
+}
+
+func jsonFieldName(name string) string {
+	if mapped, ok := jsonFieldMap[name]; ok {
+		return mapped
+	}
+	return name
+}
+
+type jsonField struct {
+	name  string
+	value any
+}
+
+// marshalOrdered encodes fields as a JSON object, keeping the given order.
+func marshalOrdered(fields []jsonField) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// floatPrecision is the number of decimals float fields are rounded to in the JSON output,
+// or negative for full precision. Set from the -float-precision flag.
+var floatPrecision = -1
+
+// roundJSONFloat rounds v to floatPrecision decimals, for output only.
+func roundJSONFloat(v float64) float64 {
+	if floatPrecision < 0 {
+		return v
+	}
+	scale := math.Pow10(floatPrecision)
+	return math.Round(v*scale) / scale
+}
+
+func (d healthData) MarshalJSON() ([]byte, error) {
+	fields := []jsonField{
+		{jsonFieldName("time"), d.Time},
+		{jsonFieldName("heartRate"), lo.Ternary[any](preciseHeartRate, roundJSONFloat(d.HeartRateValue()), d.HeartRate)},
+		{jsonFieldName("stepCount"), d.StepCount},
+		{jsonFieldName("distanceTraveled"), roundJSONFloat(d.DistanceTraveled)},
+		{jsonFieldName("speed"), roundJSONFloat(d.Speed)},
+		{jsonFieldName("calories"), d.Calories},
+		{jsonFieldName("hrvEstimate"), roundJSONFloat(d.HRVEstimate)},
+		{jsonFieldName("keyTimes"), d.KeyTimes},
+		// Derived values, ignored when decoding
+		{jsonFieldName("speedKmh"), roundJSONFloat(d.SpeedKmh())},
+		{jsonFieldName("sessionDuration"), roundJSONFloat(d.SessionDuration().Seconds())},
+	}
+	if imperialUnits {
+		fields = append(fields, jsonField{jsonFieldName("speedMph"), roundJSONFloat(d.SpeedMph())})
+	}
+	if w := d.HeartRateWindow; w != nil {
+		fields = append(fields, jsonField{jsonFieldName("heartRateWindow"), hrWindowStats{
+			WindowSeconds: w.WindowSeconds,
+			Min:           roundJSONFloat(w.Min),
+			Avg:           roundJSONFloat(w.Avg),
+			Max:           roundJSONFloat(w.Max),
+			Samples:       w.Samples,
+		}})
+	}
+	fields = append(fields, jsonField{jsonFieldName("units"), jsonUnits()})
+	return marshalOrdered(fields)
+}
+
+// fieldUnits are the units of the numeric JSON fields, see jsonUnits.
+var fieldUnits = []jsonField{
+	{"heartRate", "bpm"},
+	{"stepCount", "steps"},
+	{"distanceTraveled", "m"},
+	{"speed", "m/s"},
+	{"calories", "kcal"},
+	{"hrvEstimate", "ms"},
+	{"speedKmh", "km/h"},
+	{"sessionDuration", "s"},
+	{"speedMph", "mph"},
+}
+
+// jsonUnits returns the units of the fields present in the JSON output, keyed by their output names.
+func jsonUnits() json.RawMessage {
+	var fields []jsonField
+	for _, f := range fieldUnits {
+		if f.name == "speedMph" && !imperialUnits {
+			continue
+		}
+		fields = append(fields, jsonField{jsonFieldName(f.name), f.value})
+	}
+	b, _ := marshalOrdered(fields)
+	return b
+}
+
+// UnmarshalJSON accepts both the default and the remapped field names.
+func (d *healthData) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	// The heart rate may be fractional with -hr-precise
+	var heartRate float64
+	fields := []jsonField{
+		{"time", &d.Time},
+		{"heartRate", &heartRate},
+		{"stepCount", &d.StepCount},
+		{"distanceTraveled", &d.DistanceTraveled},
+		{"speed", &d.Speed},
+		{"calories", &d.Calories},
+		{"hrvEstimate", &d.HRVEstimate},
+		{"heartRateWindow", &d.HeartRateWindow},
+		{"keyTimes", &d.KeyTimes},
+	}
+	for _, f := range fields {
+		v, ok := raw[f.name]
+		if !ok {
+			v, ok = raw[jsonFieldName(f.name)]
+		}
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(v, f.value); err != nil {
+			return fmt.Errorf("decoding %s: %v", f.name, err)
+		}
+	}
+	d.setHeartRate(heartRate)
+
+	// Restore the session start from the reported duration
+	v, ok := raw["sessionDuration"]
+	if !ok {
+		v, ok = raw[jsonFieldName("sessionDuration")]
+	}
+	if ok {
+		var seconds float64
+		if err := json.Unmarshal(v, &seconds); err != nil {
+			return fmt.Errorf("decoding sessionDuration: %v", err)
+		}
+		d.SessionStart = d.Time.Add(-time.Duration(seconds * float64(time.Second)))
+	}
+	return nil
+}
+
+// MarshalJSON writes the times of updated fields only, under their output names.
+func (k keyTimes) MarshalJSON() ([]byte, error) {
+	var fields []jsonField
+	for _, key := range healthDataKeys {
+		if t := k.Get(key); !t.IsZero() {
+			fields = append(fields, jsonField{jsonFieldName(key), t})
+		}
+	}
+	return marshalOrdered(fields)
+}
+
+// UnmarshalJSON accepts both the default and the remapped field names.
+func (k *keyTimes) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	for _, key := range healthDataKeys {
+		v, ok := raw[key]
+		if !ok {
+			v, ok = raw[jsonFieldName(key)]
+		}
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(v, k.field(key)); err != nil {
+			return fmt.Errorf("decoding keyTimes.%s: %v", key, err)
+		}
+	}
+	return nil
+}
@@ -1,70 +1,755 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+var (
+	printVersion      = flag.Bool("version", false, "Print the version and exit")
+	versionFormat     = flag.String("version-format", "json", "Format of -version output: json, plain")
+	checkConfig       = flag.Bool("check-config", false, "Validate flags and the config file, print the resolved settings and exit without starting anything")
+	listExportersFlag = flag.Bool("list-exporters", false, "List the available exporters, whether they are enabled by the flags and config file, their flags and the updated keys they are sent, then exit")
+	configPath        = flag.String("config", "", "Path to a YAML config file, or '-' to read it from stdin; keys are flag names, plus 'osc-profiles'. Reloaded on SIGHUP, unless read from stdin")
+	logLevel          = flag.String("log-level", "info", "Log level: debug, info, warn, error")
+)
+
 // Receiving components
 var (
-	receiveMode = flag.String("receive-mode", "hds", "Receive mode: hds, ws-pull")
-	hdsPort     = flag.Int("hds-port", 3476, "HTTP port to listen on HDS data")
-	wsPullURL   = flag.String("ws-pull-url", "ws://localhost:8080/ws", "WebSocket URL to pull data from")
+	receiveMode          = flag.String("receive-mode", "hds", "Receive mode: hds, ws-pull, poll, redis, kafka")
+	receiveFallback      = flag.String("receive-fallback", "", "Receive mode to also start when -receive-mode supplied no data for -receive-fallback-after, e.g. hds (empty to disable)")
+	receiverPriority     = flag.String("receiver-priority", "", "Comma-separated receive modes in order of preference while both -receive-mode and -receive-fallback run, e.g. 'hds,ws-pull': each field comes from the first receiver whose value for it was updated within -data-ttl, so a preferred receiver going stale on one field hands over that field only (empty for the last update to win)")
+	receiveFallbackAfter = flag.String("receive-fallback-after", "30s", "Period without data from -receive-mode after which -receive-fallback is started")
+	hdsPort              = flag.Int("hds-port", 3476, "HTTP port to listen on HDS data")
+	hdsMaxBody           = flag.Int64("hds-max-body", 64*1024, "Maximum HDS request body size in bytes, also applied after gzip decompression")
+	hdsTapFile           = flag.String("hds-tap-file", "", "File to append every raw HDS payload to with its receive time, including malformed ones (empty to disable)")
+	hdsDedupWindow       = flag.String("hds-dedup-window", "0s", "Ignore an HDS payload identical to the previous one within this window, e.g. from a retrying source (0 to disable)")
+	hdsSnapshotResponse  = flag.Bool("hds-snapshot-response", false, "Respond to HDS requests sent with 'Accept: application/json' with the updated data, instead of an empty body")
+	hdsJSONErrors        = flag.Bool("hds-json-errors", false, "Respond to invalid HDS requests with a JSON body like {\"error\":\"Invalid data format\",\"code\":\"invalid_format\"} instead of plain text")
+	debugInject          = flag.Bool("debug-inject", false, "Accept 'POST /inject' on the HDS port with a body like {\"key\":\"heartRate\",\"value\":123}, applied like received data, for testing without a device; requires -debug-inject-token")
+	debugInjectToken     = flag.String("debug-inject-token", "", "Token required on POST /inject, as an 'Authorization: Bearer' header or '?token=' query parameter")
+	hdsPathMap           = flag.String("hds-path-map", "", "Additional HDS paths taking the bare value of one field as body, e.g. '/heartRate=heartRate,/steps=stepCount' accepts 'PUT /steps' with body '1234'")
+	wsPullURL            = flag.String("ws-pull-url", "ws://localhost:8080/ws", "WebSocket URL to pull data from")
+	wsPullCleanWait      = flag.String("ws-pull-clean-wait", "1s", "Fixed wait before reconnecting after -ws-pull-url closed the connection cleanly, e.g. when the server is cycling")
+	wsPullBackoff        = flag.String("ws-pull-backoff", "1s", "First wait before reconnecting after a -ws-pull-url connection error or timeout, doubling on each further failure")
+	wsPullMaxBackoff     = flag.String("ws-pull-max-backoff", "10m", "Maximum wait before reconnecting to -ws-pull-url after repeated errors")
+	wsPullBuffer         = flag.Int("ws-pull-buffer", 0, "Messages buffered between reading -ws-pull-url and the exporters, dropping the oldest when full, so that slow exporters do not stall reading (0 to call the exporters inline)")
+	pollURL              = flag.String("poll-url", "http://localhost:8080/poll", "HTTP URL to poll update messages from, as JSON or MessagePack (Content-Type application/msgpack); 204 means no update")
+	pollInterval         = flag.String("poll-interval", "0s", "Wait between polls; 0 re-requests right away, for long-polling servers")
+
+	redisSubAddr    = flag.String("redis-sub-addr", "localhost:6379", "Redis server address to subscribe to")
+	redisSubChannel = flag.String("redis-sub-channel", "hds", "Redis channel to receive update messages from")
+
+	kafkaBrokers      = flag.String("kafka-brokers", "localhost:9092", "Comma-separated Kafka broker addresses")
+	kafkaConsumeTopic = flag.String("kafka-consume-topic", "hds", "Kafka topic to consume update messages from")
+	kafkaGroup        = flag.String("kafka-group", "hds-osc", "Kafka consumer group ID")
 )
 
 // Exporting components
 var (
-	wsServerEnabled = flag.Bool("ws-server-enabled", false, "Enable WebSocket server")
-	wsServerPort    = flag.Int("ws-server-port", 8080, "WebSocket server port to listen on")
-
-	oscEnabled        = flag.Bool("osc-enabled", true, "Enable OSC sending")
-	oscSendIP         = flag.String("osc-ip", "127.0.0.1", "IP address of OSC to send data to")
-	oscSendPort       = flag.Int("osc-port", 9000, "OSC port to send data to")
-	oscAddrName       = flag.String("osc-addr", "/avatar/parameters/HeartRate", "Name of OSC address")
-	oscEnableAddrName = flag.String("osc-enable-addr", "/avatar/parameters/HREnabled", "Name of OSC address for 'enabled' parameter")
-	oscEnableDebounce = flag.String("osc-enable-debounce", "60s", "Debounce time for until sending disabled state")
-
-	promEnabled = flag.Bool("prom-enabled", false, "Enable Prometheus metrics")
-	promPort    = flag.Int("prom-port", 9090, "Prometheus metrics port to listen on")
+	dataTTL               = flag.String("data-ttl", "30s", "Time after the last received data until exporters treat it as stale")
+	jsonFieldMapFlag      = flag.String("json-field-map", "", "Rename JSON output fields, e.g. 'heartRate=hr,stepCount=steps'")
+	floatPrecisionFlag    = flag.Int("float-precision", -1, "Decimals float fields are rounded to in the JSON output, e.g. 2 (negative for full precision)")
+	hrPrecise             = flag.Bool("hr-precise", false, "Keep fractional heart rates for OSC normalization, alarms and metrics, and send them as decimals in JSON")
+	maxClockSkew          = flag.String("max-clock-skew", "0s", "Offset between data timestamps set by the source, e.g. with -receive-mode ws-pull, and the local clock above which a warning is logged; the measured skew is shown in /stats (0 to disable)")
+	clockSkewFallback     = flag.Bool("clock-skew-fallback", false, "Re-timestamp samples exceeding -max-clock-skew with the local receive time")
+	statsWindow           = flag.String("stats-window", "0s", "Window of the rolling min/avg/max heart rate in the payload and GET /stats, e.g. 5m (0 to disable)")
+	summaryInterval       = flag.String("summary-interval", "0s", "Interval of a status log line summarizing the heart rate, update rate, clients and exporter errors (0 to disable)")
+	sessionGapFlag        = flag.String("session-gap", "5m", "Time without data after which a new session starts")
+	exporterFailThreshold = flag.Int("exporter-fail-threshold", 10, "Consecutive updates failing on every exporter after which GET /ready reports not ready (0 to disable)")
+	maxRateOfChange       = flag.String("max-rate-of-change", "", "Maximum change per second of fields, e.g. 'distanceTraveled=50,speed=10,calories=5'; faster changes are rejected as glitches, except decreases of cumulative fields and values after the field went stale (empty to disable)")
+	hrMaxJump             = flag.Int("hr-max-jump", 0, "Reject heart rate samples jumping more than this BPM unless the next sample confirms them (0 to disable)")
+	maxUpdateRate         = flag.Float64("max-update-rate", 0, "Maximum received updates per second passed to the exporters, across all receivers; excess updates are dropped, keeping the most recent (0 to disable)")
+	units                 = flag.String("units", "metric", "Unit system for derived values: metric, imperial (adds mph alongside km/h)")
+
+	wsServerEnabled     = flag.Bool("ws-server-enabled", false, "Enable WebSocket server")
+	wsServerPort        = flag.Int("ws-server-port", 8080, "WebSocket server port to listen on")
+	wsServerEncoding    = flag.String("ws-server-encoding", "json", "Default WebSocket message encoding when not negotiated via subprotocol: json, msgpack")
+	wsServerAcceptInput = flag.Bool("ws-server-accept-input", false, "Also accept data pushed by /ws clients, as update messages or HDS 'key:value' texts, and feed it to the exporters; requires -ws-server-token")
+	wsServerToken       = flag.String("ws-server-token", "", "Token required on /ws, /events and POST /reset, as an 'Authorization: Bearer' header or '?token=' query parameter (empty to disable, when POST /reset is not served and /ws control messages changing the OSC profile and target are ignored)")
+	wsServerCompression = flag.Bool("ws-server-compression", false, "Offer permessage-deflate compression to WebSocket clients, at some CPU cost per frame for each client")
+	wsBatchInterval     = flag.String("ws-batch-interval", "0s", "Window in which WebSocket updates are collected and sent as one frame holding an array of messages (0 to send each update as is, unless a client negotiates the json-batch or msgpack-batch subprotocol)")
+	wsSnapshotInterval  = flag.String("ws-snapshot-interval", "0s", "Interval at which every WebSocket client is re-sent the full \"all\" snapshot, keeping clients without state in sync (0 to send it on connect only)")
+	latestMaxAge        = flag.String("latest-max-age", "0s", "Age after which GET / responds 404 instead of serving old data (0 for no limit)")
+	dashboardEnabled    = flag.Bool("dashboard-enabled", false, "Serve a live heart rate dashboard at GET /dashboard on the WebSocket server (requires default JSON field names)")
+
+	oscEnabled          = flag.Bool("osc-enabled", true, "Enable OSC sending")
+	oscSendIP           = flag.String("osc-ip", "127.0.0.1", "IP address of OSC to send data to")
+	oscSendPort         = flag.Int("osc-port", 9000, "OSC port to send data to")
+	oscBindAddr         = flag.String("osc-bind-addr", "", "Local 'ip' or 'ip:port' to send OSC packets from, e.g. to use the LAN interface when a VPN or virtual adapter holds the default route (empty for the system default)")
+	oscAddrName         = flag.String("osc-addr", "/avatar/parameters/HeartRate", "Name of OSC address")
+	oscStaleValue       = flag.String("osc-stale-value", "hold", "Value sent once on -osc-addr when data becomes stale, e.g. 0 or -1, or 'hold' to keep the last value")
+	oscHRFloatEnabled   = flag.Bool("osc-hr-float-enabled", true, "Send the normalized heart rate float on -osc-addr")
+	oscEnableAddrName   = flag.String("osc-enable-addr", "/avatar/parameters/HREnabled", "Name of OSC address for 'enabled' parameter")
+	oscEnableDebounce   = flag.String("osc-enable-debounce", "60s", "Debounce time for until sending disabled state")
+	oscEnableMinSamples = flag.Int("osc-enable-min-samples", 1, "Number of updates required before sending the enabled state after being disabled. Disabling still happens after -osc-enable-debounce without updates")
+	oscEnableWindow     = flag.String("osc-enable-window", "10s", "Maximum time between the updates counted by -osc-enable-min-samples; a longer gap restarts the count")
+	oscHRStringAddr     = flag.String("osc-hr-string-addr", "", "Name of OSC address to send the heart rate to as a string (empty to disable)")
+	oscHRStringFormat   = flag.String("osc-hr-string-format", "%d", "Go format for the heart rate string, e.g. '%03d' for leading zeros")
+	oscHRMin            = flag.Float64("osc-hr-min", 0, "Heart rate mapped to 0.0 on the OSC address")
+	oscHRMax            = flag.Float64("osc-hr-max", 256, "Heart rate mapped to 1.0 on the OSC address")
+	oscListenPort       = flag.Int("osc-listen-port", 0, "OSC port to receive control messages on (0 to disable)")
+	oscControlAddr      = flag.String("osc-control-addr", "/avatar/parameters/HRSendEnabled", "Name of OSC address whose true/false value unmutes/mutes OSC sends")
+	oscControlDisable   = flag.Bool("osc-control-disable", true, "Also send the disabled state on the 'enabled' address when muted")
+	oscFieldAddrs       = flag.String("osc-field-addrs", "", "OSC addresses for the raw values of other fields, e.g. 'stepCount=/avatar/parameters/Steps,calories=/avatar/parameters/Calories'")
+	oscFieldOnStale     = flag.String("osc-field-on-stale", "", "What the -osc-field-addrs, -osc-addr-template and normalized steps and calories addresses send once when data becomes stale, per field, e.g. 'stepCount=zero,speed=-1'; hold (default), zero or a sentinel number")
+	oscAddrTemplate     = flag.String("osc-addr-template", "", "OSC address template for the raw values of fields not in -osc-field-addrs, e.g. '/avatar/parameters/HDS_{field}'; {field} is the field name with its first letter capitalized, e.g. StepCount, DistanceTraveled, Speed, Calories")
+	oscEntries          = flag.String("osc-entries", "", "Additional typed OSC addresses as 'addr=type:transform[:field[:on-stale]]', e.g. '/avatar/parameters/HRHigh=bool:>150'; types: float, int, bool; transforms: raw, normalized (heartRate, stepCount, calories), >N, <N; field defaults to heartRate; on-stale: hold (default), zero or a sentinel number sent once when data becomes stale")
+	oscStepPulseAddr    = flag.String("osc-step-pulse-addr", "", "Name of OSC address to send a brief true pulse to each time -osc-steps-per-pulse steps accrued (empty to disable); requires stepCount in -osc-fields")
+	oscStepsPerPulse    = flag.Int("osc-steps-per-pulse", 2, "Number of steps per pulse on -osc-step-pulse-addr")
+	oscCalorieRateAddr  = flag.String("osc-calorie-rate-addr", "", "Name of OSC address to send the calorie burn rate to, normalized over [0, -osc-calorie-rate-max] kcal/min (empty to disable); requires calories in -osc-fields")
+	oscCalorieRateMax   = flag.Float64("osc-calorie-rate-max", 20, "Calorie burn rate in kcal/min mapped to 1.0 on -osc-calorie-rate-addr")
+	oscStepsNormAddr    = flag.String("osc-steps-norm-addr", "", "Name of OSC address to send the step count to, normalized over [0, -osc-steps-max] (empty to disable); requires stepCount in -osc-fields")
+	oscStepsMax         = flag.Float64("osc-steps-max", 10000, "Step count mapped to 1.0 on -osc-steps-norm-addr and normalized stepCount entries")
+	oscCaloriesNormAddr = flag.String("osc-calories-norm-addr", "", "Name of OSC address to send the calories to, normalized over [0, -osc-calories-max] (empty to disable); requires calories in -osc-fields")
+	oscCaloriesMax      = flag.Float64("osc-calories-max", 500, "Calories in kcal mapped to 1.0 on -osc-calories-norm-addr and normalized calories entries")
+	oscAlarmAddr        = flag.String("osc-alarm-addr", "", "Name of OSC address to send a brief true pulse to when the heart rate crosses above -osc-alarm-hr (empty to disable)")
+	oscAlarmHR          = flag.Float64("osc-alarm-hr", 160, "Heart rate at or above which -osc-alarm-addr fires")
+	oscAlarmHysteresis  = flag.Float64("osc-alarm-hysteresis", 10, "BPM heart rate must drop below -osc-alarm-hr before the alarm can fire again")
+	oscAlarmCooldown    = flag.String("osc-alarm-cooldown", "60s", "Minimum time between two -osc-alarm-addr pulses")
+	oscBundle           = flag.Bool("osc-bundle", true, "Send the messages of an update together in one OSC bundle with a common timetag; false sends them one by one")
+	oscFixedRate        = flag.Float64("osc-fixed-rate", 0, "Send the latest values this many times per second instead of on each update, e.g. 10, until data goes stale (0 to send on updates)")
+	oscDebugFile        = flag.String("osc-debug-file", "", "Append each OSC message sent, with its address, typed arguments and send time, to this file for debugging (empty to disable)")
+	oscFields           = flag.String("osc-fields", "heartRate", "Comma-separated fields to send over OSC, even if other fields have an address configured")
+	oscQueryEnabled     = flag.Bool("oscquery-enabled", false, "Serve the sent OSC addresses over OSCQuery and advertise them via mDNS, including -osc-listen-port if set")
+	oscQueryPort        = flag.Int("oscquery-port", 0, "OSCQuery HTTP port to listen on (0 for a random port)")
+	oscActiveProfile    = flag.String("osc-active-profile", "default", "Name of the OSC profile to start with; 'default' is built from the -osc-* flags, others from 'osc-profiles' in the config file")
+
+	grpcPort   = flag.Int("grpc-port", 0, "gRPC server port to listen on (0 to disable)")
+	unixSocket = flag.String("unix-socket", "", "Path of a Unix socket to stream update messages to local processes on (empty to disable)")
+
+	promEnabled      = flag.Bool("prom-enabled", false, "Enable Prometheus metrics")
+	promPort         = flag.Int("prom-port", 9090, "Prometheus metrics port to listen on")
+	promNamespace    = flag.String("prom-namespace", "", "Prefix for all metric names, e.g. 'hds' gives 'hds_heart_rate'. The default generic names like 'speed' may collide with other exporters' metrics")
+	promStalenessKey = flag.String("prom-staleness-key", "any", "Field whose freshness gates the health metrics, e.g. heartRate, or 'any' for any field, 'all' for every field received")
+	promGoMetrics    = flag.Bool("prom-go-metrics", false, "Also expose Go runtime and process metrics (goroutines, GC, memory)")
+	promAuthUser     = flag.String("prom-auth-user", "", "Basic auth user required for the metrics endpoint (empty to disable auth)")
+	promAuthPass     = flag.String("prom-auth-pass", "", "Basic auth password required for the metrics endpoint")
+	promTLSCert      = flag.String("prom-tls-cert", "", "TLS certificate file to serve metrics over HTTPS (empty for plain HTTP)")
+	promTLSKey       = flag.String("prom-tls-key", "", "TLS private key file for -prom-tls-cert")
+
+	promRemoteWriteURL      = flag.String("prom-remote-write-url", "", "Prometheus remote-write URL to push metrics to (empty to disable), using -prom-namespace")
+	promRemoteWriteInterval = flag.String("prom-remote-write-interval", "15s", "Interval between remote-write pushes")
+	promRemoteWriteUser     = flag.String("prom-remote-write-user", "", "Basic auth user for remote-write (empty to disable auth)")
+	promRemoteWritePass     = flag.String("prom-remote-write-pass", "", "Basic auth password for remote-write")
+
+	otelEnabled  = flag.Bool("otel-enabled", false, "Enable OpenTelemetry metrics push")
+	otelEndpoint = flag.String("otel-endpoint", "http://localhost:4318", "OTLP HTTP endpoint to push metrics to")
+	otelInterval = flag.String("otel-interval", "15s", "Interval between OTel metrics pushes")
+
+	cloudWatchEnabled    = flag.Bool("cloudwatch-enabled", false, "Enable CloudWatch metrics push, using the default AWS credential chain")
+	cloudWatchNamespace  = flag.String("cloudwatch-namespace", "HDS", "CloudWatch namespace of the metrics")
+	cloudWatchDimensions = flag.String("cloudwatch-dimensions", "", "Dimensions of the metrics, e.g. 'User=alice,Device=watch'")
+	cloudWatchRegion     = flag.String("cloudwatch-region", "", "AWS region (empty for the SDK default, e.g. from AWS_REGION)")
+	cloudWatchInterval   = flag.String("cloudwatch-interval", "60s", "Interval between CloudWatch pushes")
+
+	azureIKey     = flag.String("azure-ikey", "", "Application Insights instrumentation key to send metrics with (empty to disable)")
+	azureEndpoint = flag.String("azure-endpoint", "https://dc.services.visualstudio.com/v2/track", "Application Insights ingestion endpoint, e.g. the IngestionEndpoint of the connection string followed by v2/track")
+	azureInterval = flag.String("azure-interval", "60s", "Interval between Application Insights pushes")
+
+	natsEnabled  = flag.Bool("nats-enabled", false, "Enable NATS publishing")
+	natsURL      = flag.String("nats-url", "nats://localhost:4222", "NATS server URL to publish to")
+	natsSubject  = flag.String("nats-subject", "hds", "NATS subject to publish update messages to")
+	natsPerField = flag.Bool("nats-per-field", false, "Also publish each changed field's value to '<subject>.<key>'")
+
+	redisEnabled = flag.Bool("redis-enabled", false, "Enable Redis publishing")
+	redisAddr    = flag.String("redis-addr", "localhost:6379", "Redis server address")
+	redisChannel = flag.String("redis-channel", "hds", "Redis channel to publish update messages to")
+	redisKey     = flag.String("redis-key", "", "Redis key to store the latest data in, expiring after -data-ttl (empty to disable)")
+
+	kafkaEnabled      = flag.Bool("kafka-enabled", false, "Enable Kafka producing (brokers from -kafka-brokers)")
+	kafkaProduceTopic = flag.String("kafka-produce-topic", "hds-out", "Kafka topic to produce update messages to")
+
+	syslogEnabled = flag.Bool("syslog-enabled", false, "Enable exporting data as RFC5424 syslog messages")
+	syslogNetwork = flag.String("syslog-network", "udp", "Network to send syslog messages over: udp, tcp")
+	syslogAddr    = flag.String("syslog-addr", "localhost:514", "Syslog server address")
+
+	graphiteEnabled = flag.Bool("graphite-enabled", false, "Enable sending the fields to Graphite as plaintext protocol lines over TCP")
+	graphiteAddr    = flag.String("graphite-addr", "localhost:2003", "Graphite (Carbon) plaintext listener address")
+	graphitePrefix  = flag.String("graphite-prefix", "hds", "Prefix of the metric paths, e.g. 'hds' for 'hds.heart_rate'")
+
+	alertHRHigh       = flag.Float64("alert-hr-high", 180, "Heart rate at or above which alerting exporters fire (0 to disable)")
+	alertHRLow        = flag.Float64("alert-hr-low", 0, "Heart rate at or below which alerting exporters fire (0 to disable)")
+	alertHRHysteresis = flag.Float64("alert-hr-hysteresis", 5, "BPM heart rate must move back past a threshold before the alert clears")
+
+	telegramEnabled = flag.Bool("telegram-enabled", false, "Enable Telegram heart rate alerts (thresholds from -alert-hr-*)")
+	telegramToken   = flag.String("telegram-token", "", "Telegram bot token")
+	telegramChatID  = flag.String("telegram-chat-id", "", "Telegram chat ID to send alerts to")
+
+	slackEnabled         = flag.Bool("slack-enabled", false, "Enable Slack incoming webhook messages")
+	slackWebhookURL      = flag.String("slack-webhook-url", "", "Slack incoming webhook URL")
+	slackMode            = flag.String("slack-mode", "alert", "Slack mode: alert (thresholds from -alert-hr-*), summary")
+	slackSummaryInterval = flag.String("slack-summary-interval", "10m", "Interval between heart rate summaries in summary mode")
+
+	obsEnabled     = flag.Bool("obs-enabled", false, "Enable updating an OBS text source via OBS WebSocket v5")
+	obsURL         = flag.String("obs-url", "ws://localhost:4455", "OBS WebSocket URL")
+	obsPassword    = flag.String("obs-password", "", "OBS WebSocket password")
+	obsSource      = flag.String("obs-source", "HeartRate", "Name of the OBS text source to update")
+	obsFormat      = flag.String("obs-format", "{hr} BPM", "Text format; placeholders: {hr}, {steps}, {calories}")
+	obsMinInterval = flag.String("obs-min-interval", "500ms", "Minimum interval between OBS text updates")
 )
 
 func main() {
 	slog.Info("hds-osc", "version", GetFormattedVersion())
+
+	// Service management subcommands, e.g. "hds-osc install -osc-port 9000"
+	if len(os.Args) > 1 && (os.Args[1] == "install" || os.Args[1] == "uninstall") {
+		if err := serviceCommand(os.Args[1], os.Args[2:]); err != nil {
+			slog.Error("Service command failed", "command", os.Args[1], "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
 
-	var exporters []exporter
-	if *wsServerEnabled {
-		slog.Info("WebSocket server enabled", "port", *wsServerPort)
-		exporters = append(exporters, newHTTPServerExporter(*wsServerPort))
+	if *printVersion {
+		switch *versionFormat {
+		case "json":
+			_ = json.NewEncoder(os.Stdout).Encode(GetVersionInfo())
+		case "plain":
+			fmt.Println(GetFormattedVersion())
+		default:
+			slog.Error("Invalid version format", "format", *versionFormat)
+			os.Exit(1)
+		}
+		return
 	}
-	if *oscEnabled {
-		slog.Info("OSC enabled", "ip", *oscSendIP, "port", *oscSendPort, "addr", *oscAddrName)
-		enableDebounce, err := time.ParseDuration(*oscEnableDebounce)
+
+	if isService() {
+		runService(run)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	run(ctx)
+}
+
+// run starts all components and blocks until ctx is cancelled or the receiver stops.
+func run(ctx context.Context) {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	// shutdown tracks components that need to finish cleaning up before exiting
+	var shutdown sync.WaitGroup
+
+	cfg := &fileConfig{}
+	if *configPath != "" {
+		var err error
+		cfg, err = loadConfig(*configPath)
 		if err != nil {
-			slog.Error("Invalid debounce time", "err", err)
+			slog.Error("Loading config", "err", err)
 			os.Exit(1)
 		}
-		exporters = append(exporters, newOSCExporter(*oscSendIP, *oscSendPort, *oscAddrName, *oscEnableAddrName, enableDebounce))
 	}
-	if *promEnabled {
-		slog.Info("Prometheus enabled", "port", *promPort)
-		exporters = append(exporters, newPrometheusExporter(*promPort))
+
+	if err := applyLogLevel(); err != nil {
+		slog.Error("Invalid log level", "err", err)
+		os.Exit(1)
 	}
 
-	var r receiver
-	switch *receiveMode {
-	case "hds":
-		slog.Info("HTTP HDS receiver enabled", "port", *hdsPort, "exporters", len(exporters))
-		r = newHDSReceiver(exporters)
-	case "ws-pull":
-		slog.Info("WebSocket pull receiver enabled", "url", *wsPullURL, "exporters", len(exporters))
-		r = newWSPullReceiver(exporters, *wsPullURL)
+	var err error
+	dataStaleAfter, err = time.ParseDuration(*dataTTL)
+	if err != nil {
+		slog.Error("Invalid data TTL", "err", err)
+		os.Exit(1)
+	}
+	sessionGap, err = time.ParseDuration(*sessionGapFlag)
+	if err != nil {
+		slog.Error("Invalid session gap", "err", err)
+		os.Exit(1)
+	}
+	preciseHeartRate = *hrPrecise
+	floatPrecision = *floatPrecisionFlag
+	summaryIntervalDur, err := time.ParseDuration(*summaryInterval)
+	if err != nil {
+		slog.Error("Invalid summary interval", "err", err)
+		os.Exit(1)
+	}
+	maxRates, err := parseMaxRates(*maxRateOfChange)
+	if err != nil {
+		slog.Error("Invalid max rate of change", "err", err)
+		os.Exit(1)
+	}
+	statsWindowDur, err := time.ParseDuration(*statsWindow)
+	if err != nil {
+		slog.Error("Invalid stats window", "err", err)
+		os.Exit(1)
+	}
+	maxClockSkewDur, err := time.ParseDuration(*maxClockSkew)
+	if err != nil {
+		slog.Error("Invalid max clock skew", "err", err)
+		os.Exit(1)
+	}
+	switch *units {
+	case "metric":
+	case "imperial":
+		imperialUnits = true
 	default:
+		slog.Error("Invalid units", "units", *units)
+		os.Exit(1)
+	}
+	jsonFieldMap, err = parseJSONFieldMap(*jsonFieldMapFlag)
+	if err != nil {
+		slog.Error("Invalid JSON field map", "err", err)
+		os.Exit(1)
+	}
+
+	if *listExportersFlag {
+		listExporters(os.Stdout)
+		return
+	}
+
+	// Validate component settings before starting anything, so that -check-config catches them
+	receiveModes := []string{"hds", "ws-pull", "poll", "redis", "kafka"}
+	if !slices.Contains(receiveModes, *receiveMode) {
 		slog.Error("Invalid receive mode", "mode", *receiveMode)
 		os.Exit(1)
 	}
+	wsPullCleanWaitDur, err := time.ParseDuration(*wsPullCleanWait)
+	if err != nil {
+		slog.Error("Invalid WebSocket pull clean wait", "err", err)
+		os.Exit(1)
+	}
+	wsPullBackoffDur, err := time.ParseDuration(*wsPullBackoff)
+	if err != nil {
+		slog.Error("Invalid WebSocket pull backoff", "err", err)
+		os.Exit(1)
+	}
+	wsPullMaxBackoffDur, err := time.ParseDuration(*wsPullMaxBackoff)
+	if err != nil || wsPullMaxBackoffDur < wsPullBackoffDur {
+		slog.Error("Invalid WebSocket pull max backoff, must be at least -ws-pull-backoff", "value", *wsPullMaxBackoff)
+		os.Exit(1)
+	}
+	if *wsPullBuffer < 0 {
+		slog.Error("Invalid WebSocket pull buffer", "size", *wsPullBuffer)
+		os.Exit(1)
+	}
+	var receiveFallbackAfterDur time.Duration
+	if *receiveFallback != "" {
+		if !slices.Contains(receiveModes, *receiveFallback) || *receiveFallback == *receiveMode {
+			slog.Error("Invalid receive fallback mode, must be another receive mode", "mode", *receiveFallback)
+			os.Exit(1)
+		}
+		receiveFallbackAfterDur, err = time.ParseDuration(*receiveFallbackAfter)
+		if err != nil {
+			slog.Error("Invalid receive fallback period", "err", err)
+			os.Exit(1)
+		}
+	}
+	var receiverPriorityModes []string
+	if *receiverPriority != "" {
+		receiverPriorityModes = strings.Split(*receiverPriority, ",")
+		for _, mode := range receiverPriorityModes {
+			if !slices.Contains(receiveModes, mode) {
+				slog.Error("Invalid receiver priority mode", "mode", mode)
+				os.Exit(1)
+			}
+		}
+		if *receiveFallback == "" {
+			slog.Warn("-receiver-priority has no effect without -receive-fallback")
+		}
+	}
+	pollIntervalDur, err := time.ParseDuration(*pollInterval)
+	if err != nil {
+		slog.Error("Invalid poll interval", "err", err)
+		os.Exit(1)
+	}
+	if *maxUpdateRate < 0 {
+		slog.Error("Max update rate must not be negative", "value", *maxUpdateRate)
+		os.Exit(1)
+	}
+	hdsPaths, err := parseHDSPathMap(*hdsPathMap)
+	if err != nil {
+		slog.Error("Invalid HDS path map", "err", err)
+		os.Exit(1)
+	}
+	hdsDedupWindowDur, err := time.ParseDuration(*hdsDedupWindow)
+	if err != nil {
+		slog.Error("Invalid HDS dedup window", "err", err)
+		os.Exit(1)
+	}
+	if *wsServerEnabled && *wsServerEncoding != wsEncodingJSON && *wsServerEncoding != wsEncodingMsgpack {
+		slog.Error("Invalid WebSocket server encoding", "encoding", *wsServerEncoding)
+		os.Exit(1)
+	}
+	if *debugInject && *debugInjectToken == "" {
+		slog.Error("-debug-inject requires -debug-inject-token, so that only authenticated clients inject data")
+		os.Exit(1)
+	}
+	if *debugInject && *receiveMode != "hds" && *receiveFallback != "hds" {
+		slog.Error("-debug-inject requires the hds receive mode, as -receive-mode or -receive-fallback")
+		os.Exit(1)
+	}
+	if *wsServerEnabled && *wsServerAcceptInput && *wsServerToken == "" {
+		slog.Error("-ws-server-accept-input requires -ws-server-token, so that only authenticated clients push data")
+		os.Exit(1)
+	}
+	if _, err := time.ParseDuration(*latestMaxAge); err != nil {
+		slog.Error("Invalid latest max age", "err", err)
+		os.Exit(1)
+	}
+	if _, err := time.ParseDuration(*wsBatchInterval); err != nil {
+		slog.Error("Invalid WebSocket batch interval", "err", err)
+		os.Exit(1)
+	}
+	if _, err := time.ParseDuration(*wsSnapshotInterval); err != nil {
+		slog.Error("Invalid WebSocket snapshot interval", "err", err)
+		os.Exit(1)
+	}
+	var oscProfiles map[string]oscProfile
+	if *oscEnabled {
+		if _, err := time.ParseDuration(*oscEnableDebounce); err != nil {
+			slog.Error("Invalid debounce time", "err", err)
+			os.Exit(1)
+		}
+		if _, err := time.ParseDuration(*oscEnableWindow); err != nil {
+			slog.Error("Invalid enable window", "err", err)
+			os.Exit(1)
+		}
+		if *oscEnableMinSamples < 1 {
+			slog.Error("OSC enable min samples must be at least 1", "value", *oscEnableMinSamples)
+			os.Exit(1)
+		}
+		if *oscBindAddr != "" {
+			if _, _, err := parseOSCBindAddr(*oscBindAddr); err != nil {
+				slog.Error("Invalid OSC bind address", "err", err)
+				os.Exit(1)
+			}
+		}
+		if *oscFixedRate < 0 {
+			slog.Error("Invalid OSC fixed rate", "rate", *oscFixedRate)
+			os.Exit(1)
+		}
+		oscFieldList, err := parseOSCFields(*oscFields)
+		if err != nil {
+			slog.Error("Invalid OSC fields", "err", err)
+			os.Exit(1)
+		}
+		if *oscStepPulseAddr != "" && !slices.Contains(oscFieldList, "stepCount") {
+			slog.Warn("OSC step pulse address is set, but stepCount is not in -osc-fields; no pulses will be sent")
+		}
+		if *oscCalorieRateAddr != "" && !slices.Contains(oscFieldList, "calories") {
+			slog.Warn("OSC calorie rate address is set, but calories is not in -osc-fields; no rate will be sent")
+		}
+		if *oscStepsNormAddr != "" && !slices.Contains(oscFieldList, "stepCount") {
+			slog.Warn("OSC normalized steps address is set, but stepCount is not in -osc-fields; no steps will be sent")
+		}
+		if *oscCaloriesNormAddr != "" && !slices.Contains(oscFieldList, "calories") {
+			slog.Warn("OSC normalized calories address is set, but calories is not in -osc-fields; no calories will be sent")
+		}
+		defaultProfile, err := defaultOSCProfile()
+		if err != nil {
+			slog.Error("Invalid OSC addresses", "err", err)
+			os.Exit(1)
+		}
+		oscProfiles, err = buildOSCProfiles(defaultProfile, cfg.oscProfiles)
+		if err != nil {
+			slog.Error("Invalid OSC profiles", "err", err)
+			os.Exit(1)
+		}
+		if _, ok := oscProfiles[*oscActiveProfile]; !ok {
+			slog.Error("Unknown OSC profile", "profile", *oscActiveProfile)
+			os.Exit(1)
+		}
+	}
+	if *promEnabled && (*promTLSCert == "") != (*promTLSKey == "") {
+		slog.Error("Both -prom-tls-cert and -prom-tls-key are required for TLS")
+		os.Exit(1)
+	}
+	if *promRemoteWriteURL != "" {
+		if _, err := time.ParseDuration(*promRemoteWriteInterval); err != nil {
+			slog.Error("Invalid remote-write interval", "err", err)
+			os.Exit(1)
+		}
+	}
+	if *otelEnabled {
+		if _, err := time.ParseDuration(*otelInterval); err != nil {
+			slog.Error("Invalid OTel interval", "err", err)
+			os.Exit(1)
+		}
+	}
+	if *cloudWatchEnabled {
+		if _, err := time.ParseDuration(*cloudWatchInterval); err != nil {
+			slog.Error("Invalid CloudWatch interval", "err", err)
+			os.Exit(1)
+		}
+	}
+	if *azureIKey != "" {
+		if _, err := time.ParseDuration(*azureInterval); err != nil {
+			slog.Error("Invalid Application Insights interval", "err", err)
+			os.Exit(1)
+		}
+	}
+	if *syslogEnabled && *syslogNetwork != "udp" && *syslogNetwork != "tcp" {
+		slog.Error("Invalid syslog network", "network", *syslogNetwork)
+		os.Exit(1)
+	}
+	if *telegramEnabled && (*telegramToken == "" || *telegramChatID == "") {
+		slog.Error("Telegram token and chat ID are required")
+		os.Exit(1)
+	}
+	if *slackEnabled {
+		if *slackWebhookURL == "" {
+			slog.Error("Slack webhook URL is required")
+			os.Exit(1)
+		}
+		switch *slackMode {
+		case "alert":
+		case "summary":
+			if _, err := time.ParseDuration(*slackSummaryInterval); err != nil {
+				slog.Error("Invalid slack summary interval", "err", err)
+				os.Exit(1)
+			}
+		default:
+			slog.Error("Invalid slack mode", "mode", *slackMode)
+			os.Exit(1)
+		}
+	}
+	if *obsEnabled {
+		if _, err := time.ParseDuration(*obsMinInterval); err != nil {
+			slog.Error("Invalid OBS interval", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if *checkConfig {
+		printResolvedConfig()
+		return
+	}
+
+	env := &exporterEnv{ctx: ctx, shutdown: &shutdown, oscProfiles: oscProfiles}
+	exporters, err := createExporters(env)
+	if err != nil {
+		slog.Error("Creating exporters", "err", err)
+		os.Exit(1)
+	}
+	wsServer, oscExp := env.wsServer, env.oscExp
+	// Control messages change the OSC target, so they are only accepted from authenticated clients
+	if wsServer != nil && oscExp != nil && *wsServerToken != "" {
+		wsServer.setOnControl(oscExp.handleControl)
+	} else if wsServer != nil && oscExp != nil {
+		slog.Info("WebSocket control messages disabled, as they require -ws-server-token")
+	}
+
+	// Processing stages, each wrapping the rest of the pipeline
+	pipeline := exporters
+	if *exporterFailThreshold > 0 && len(exporters) > 0 {
+		pipeline = []exporter{newAllFailDetector(pipeline, *exporterFailThreshold)}
+	}
+	pipeline = []exporter{newHRVEstimator(pipeline)}
+	if statsWindowDur > 0 {
+		slog.Info("Heart rate window stats enabled", "window", statsWindowDur)
+		pipeline = []exporter{newHRWindowAggregator(pipeline, statsWindowDur)}
+	}
+	if *hrMaxJump > 0 {
+		slog.Info("Heart rate jump filter enabled", "maxJump", *hrMaxJump)
+		pipeline = []exporter{newHRJumpFilter(pipeline, *hrMaxJump)}
+	}
+	if len(maxRates) > 0 {
+		slog.Info("Rate of change guard enabled", "maxPerSecond", maxRates)
+		pipeline = []exporter{newRateGuard(pipeline, maxRates)}
+	}
+	if summaryIntervalDur > 0 {
+		summary := newSummaryLogger(pipeline, exporters, env.hub)
+		go summary.run(ctx, summaryIntervalDur)
+		pipeline = []exporter{summary}
+	}
+	if maxClockSkewDur > 0 {
+		slog.Info("Clock skew detection enabled", "max", maxClockSkewDur, "fallback", *clockSkewFallback)
+		pipeline = []exporter{newClockSkewDetector(pipeline, maxClockSkewDur, *clockSkewFallback)}
+	}
+	pipeline = []exporter{newDisconnectDetector(pipeline)}
+	if *maxUpdateRate > 0 {
+		slog.Info("Update rate limit enabled", "perSecond", *maxUpdateRate)
+		pipeline = []exporter{newUpdateRateLimiter(pipeline, *maxUpdateRate)}
+	}
+	if wsServer != nil && *wsServerAcceptInput {
+		slog.Info("WebSocket server accepting pushed data")
+		wsServer.setInput(pipeline)
+	}
+
+	var tap io.Writer
+	if *hdsTapFile != "" && (*receiveMode == "hds" || *receiveFallback == "hds") {
+		f, err := os.OpenFile(*hdsTapFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			slog.Error("Opening HDS tap file", "err", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		slog.Info("HDS tap enabled", "file", *hdsTapFile)
+		tap = f
+	}
+	newReceiver := func(mode string, exporters []exporter) receiver {
+		switch mode {
+		case "hds":
+			slog.Info("HTTP HDS receiver enabled", "port", *hdsPort)
+			injectToken := ""
+			if *debugInject {
+				slog.Warn("Debug inject endpoint enabled, do not use in production", "port", *hdsPort)
+				injectToken = *debugInjectToken
+			}
+			return newHDSReceiver(exporters, *hdsMaxBody, hdsDedupWindowDur, tap, *hdsJSONErrors, *hdsSnapshotResponse, hdsPaths, injectToken)
+		case "ws-pull":
+			slog.Info("WebSocket pull receiver enabled", "url", *wsPullURL, "buffer", *wsPullBuffer)
+			return newWSPullReceiver(exporters, *wsPullURL, *wsPullBuffer, wsPullCleanWaitDur, wsPullBackoffDur, wsPullMaxBackoffDur)
+		case "poll":
+			slog.Info("HTTP poll receiver enabled", "url", *pollURL, "interval", pollIntervalDur)
+			return newPollReceiver(exporters, *pollURL, pollIntervalDur)
+		case "redis":
+			slog.Info("Redis subscribe receiver enabled", "addr", *redisSubAddr, "channel", *redisSubChannel)
+			return newRedisReceiver(exporters, *redisSubAddr, *redisSubChannel)
+		default:
+			slog.Info("Kafka consumer receiver enabled", "brokers", *kafkaBrokers, "topic", *kafkaConsumeTopic, "group", *kafkaGroup)
+			return newKafkaReceiver(ctx, exporters, strings.Split(*kafkaBrokers, ","), *kafkaConsumeTopic, *kafkaGroup)
+		}
+	}
+	slog.Info("Exporters enabled", "count", len(exporters))
+	var r receiver
+	if *receiveFallback != "" {
+		slog.Info("Receive fallback enabled", "primary", *receiveMode, "fallback", *receiveFallback, "after", receiveFallbackAfterDur, "priority", receiverPriorityModes)
+		r = newFallbackReceiver(*receiveMode, *receiveFallback, receiveFallbackAfterDur, receiverPriorityModes, pipeline, newReceiver)
+	} else {
+		r = newReceiver(*receiveMode, pipeline)
+	}
 
-	r.Start()
+	if *configPath != "" && *configPath != configStdin {
+		go watchReload(ctx, *configPath, func(cfg *fileConfig) {
+			if err := applyLogLevel(); err != nil {
+				slog.Error("Invalid log level", "err", err)
+			}
+			for _, a := range env.alerters {
+				a.SetThresholds(*alertHRHigh, *alertHRLow, *alertHRHysteresis)
+			}
+			if oscExp != nil {
+				defaultProfile, err := defaultOSCProfile()
+				var profiles map[string]oscProfile
+				if err == nil {
+					profiles, err = buildOSCProfiles(defaultProfile, cfg.oscProfiles)
+				}
+				if err == nil {
+					err = oscExp.SetProfiles(profiles)
+				}
+				if err != nil {
+					slog.Error("Applying OSC profiles", "err", err)
+				}
+				if err := oscExp.SetTarget(*oscSendIP, *oscSendPort); err != nil {
+					slog.Error("Applying OSC target", "err", err)
+				}
+			}
+			slog.Info("Config reloaded")
+		})
+	}
+
+	if l, ok := r.(listeningReceiver); ok {
+		if err := l.Listen(); err != nil {
+			slog.Error("Receiver listen", "err", err)
+			os.Exit(1)
+		}
+	}
+	go func() {
+		// Receivers only return when they failed to start, or once stopping on shutdown
+		r.Start()
+		stop()
+	}()
+
+	// All listeners are bound at this point
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Error("Notifying systemd", "err", err)
+	}
+	if interval := sdWatchdogInterval(); interval > 0 {
+		slog.Info("Systemd watchdog enabled", "interval", interval)
+		go runSDWatchdog(ctx, interval)
+	}
+
+	<-ctx.Done()
+	slog.Info("Shutting down...")
+	_ = sdNotify("STOPPING=1")
+	shutdown.Wait()
+}
+
+func applyLogLevel() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		return err
+	}
+	slog.SetLogLoggerLevel(level)
+	return nil
+}
+
+// printResolvedConfig prints all flag values after applying the config file, masking secrets.
+func printResolvedConfig() {
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if value != "" && isSecretFlag(f.Name) {
+			value = "********"
+		}
+		fmt.Printf("%s: %q\n", f.Name, value)
+	})
+}
+
+func isSecretFlag(name string) bool {
+	for _, s := range []string{"pass", "token", "webhook-url"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultOSCProfile builds the "default" OSC profile from the -osc-* flags.
+func defaultOSCProfile() (oscProfile, error) {
+	fieldAddrs, err := parseOSCFieldAddrs(*oscFieldAddrs)
+	if err != nil {
+		return oscProfile{}, err
+	}
+	fieldOnStale, err := parseOSCFieldOnStale(*oscFieldOnStale)
+	if err != nil {
+		return oscProfile{}, err
+	}
+	entries, err := parseOSCEntries(*oscEntries)
+	if err != nil {
+		return oscProfile{}, err
+	}
+	alarmCooldown, err := time.ParseDuration(*oscAlarmCooldown)
+	if err != nil {
+		return oscProfile{}, fmt.Errorf("invalid alarm cooldown: %v", err)
+	}
+	return oscProfile{
+		Addr:             *oscAddrName,
+		HRFloatEnabled:   *oscHRFloatEnabled,
+		StaleValue:       *oscStaleValue,
+		HRMin:            *oscHRMin,
+		HRMax:            *oscHRMax,
+		HRStringAddr:     *oscHRStringAddr,
+		HRStringFormat:   *oscHRStringFormat,
+		EnableAddr:       *oscEnableAddrName,
+		FieldAddrs:       fieldAddrs,
+		AddrTemplate:     *oscAddrTemplate,
+		FieldOnStale:     fieldOnStale,
+		Entries:          entries,
+		StepPulseAddr:    *oscStepPulseAddr,
+		StepsPerPulse:    *oscStepsPerPulse,
+		CalorieRateAddr:  *oscCalorieRateAddr,
+		CalorieRateMax:   *oscCalorieRateMax,
+		StepsNormAddr:    *oscStepsNormAddr,
+		StepsMax:         *oscStepsMax,
+		CaloriesNormAddr: *oscCaloriesNormAddr,
+		CaloriesMax:      *oscCaloriesMax,
+		AlarmAddr:        *oscAlarmAddr,
+		AlarmHR:          *oscAlarmHR,
+		AlarmHysteresis:  *oscAlarmHysteresis,
+		AlarmCooldown:    alarmCooldown,
+	}, nil
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket message encodings, also used as subprotocol names for negotiation, see also wsBatchSuffix
+const (
+	wsEncodingJSON    = "json"
+	wsEncodingMsgpack = "msgpack"
+)
+
+// marshalMsgpack encodes v as MessagePack, using the same field names as the default JSON encoding.
+func marshalMsgpack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalMsgpack(b []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
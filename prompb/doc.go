@@ -0,0 +1,4 @@
+// Package prompb contains the generated Prometheus remote-write protocol messages.
+package prompb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative remote.proto
@@ -0,0 +1,54 @@
+package main
+
+import "time"
+
+// rateTracker derives a per-minute rate from consecutive samples of a cumulative value.
+type rateTracker struct {
+	lastValue float64
+	lastTime  time.Time
+	rate      float64
+}
+
+// Update feeds a new sample and returns the current rate.
+func (r *rateTracker) Update(value float64, t time.Time) float64 {
+	switch {
+	case r.lastTime.IsZero():
+		// First sample, nothing to derive from yet
+	case value < r.lastValue:
+		// The source was reset (e.g. a new session), which is not a negative rate
+		r.rate = 0
+	case !t.After(r.lastTime):
+		// Same timestamp; keep the previous sample so the next rate spans both increments
+		return r.rate
+	default:
+		r.rate = (value - r.lastValue) / t.Sub(r.lastTime).Minutes()
+	}
+	r.lastValue, r.lastTime = value, t
+	return r.rate
+}
+
+// Rate returns the last derived rate.
+func (r *rateTracker) Rate() float64 {
+	return r.rate
+}
+
+// monotonicCounter accumulates a cumulative value that the source may reset to a lower
+// value (e.g. a new session), into a total that never decreases, for Prometheus counters.
+type monotonicCounter struct {
+	// base is the sum of the values reached before each reset
+	base float64
+	last float64
+}
+
+// Update feeds the current source value.
+func (c *monotonicCounter) Update(value float64) {
+	if value < c.last {
+		c.base += c.last
+	}
+	c.last = value
+}
+
+// Total returns the accumulated total.
+func (c *monotonicCounter) Total() float64 {
+	return c.base + c.last
+}
@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func TestMonotonicCounter(t *testing.T) {
+	// resetBases is a step resetting the counter bases as POST /reset?counters=true does
+	const resetBases = -1
+
+	tests := []struct {
+		name   string
+		values []float64
+		want   []float64
+	}{
+		{
+			name:   "increasing",
+			values: []float64{0, 10, 25, 25},
+			want:   []float64{0, 10, 25, 25},
+		},
+		{
+			name:   "drop to zero",
+			values: []float64{100, 0, 20},
+			want:   []float64{100, 100, 120},
+		},
+		{
+			name:   "partial drop",
+			values: []float64{100, 40, 60},
+			want:   []float64{100, 140, 160},
+		},
+		{
+			name:   "repeated resets across sessions",
+			values: []float64{50, 0, 30, 0, 0, 10, 5},
+			want:   []float64{50, 50, 80, 80, 80, 90, 95},
+		},
+		{
+			name:   "bases reset",
+			values: []float64{100, 0, 20, resetBases, 30, 0, 5},
+			want:   []float64{100, 100, 120, 20, 30, 30, 35},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var steps, distance, calories monotonicCounter
+			for i, v := range tt.values {
+				if v == resetBases {
+					resetCounterBases(&steps, &distance, &calories)
+				} else {
+					steps.Update(v)
+				}
+				if got := steps.Total(); got != tt.want[i] {
+					t.Errorf("step %d (value %v): Total() = %v, want %v", i, v, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestResetCounterBasesReturnsTotals(t *testing.T) {
+	var steps, distance, calories monotonicCounter
+	for _, v := range []float64{500, 100} {
+		steps.Update(v)
+		distance.Update(v / 100)
+		calories.Update(v / 10)
+	}
+
+	got := resetCounterBases(&steps, &distance, &calories)
+	want := counterTotals{StepCount: 600, DistanceTraveled: 6, Calories: 60}
+	if got != want {
+		t.Errorf("resetCounterBases() = %+v, want %+v", got, want)
+	}
+	if steps.Total() != 100 || distance.Total() != 1 || calories.Total() != 10 {
+		t.Errorf("totals after reset = %v, %v, %v, want the current values 100, 1, 10", steps.Total(), distance.Total(), calories.Total())
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// notReady holds the reasons the process is currently not ready, keyed by component.
+var (
+	notReady     = map[string]string{}
+	notReadyLock sync.Mutex
+)
+
+// setNotReady marks component as not ready for reason, or as ready again if reason is empty.
+func setNotReady(component, reason string) {
+	notReadyLock.Lock()
+	defer notReadyLock.Unlock()
+	if reason == "" {
+		delete(notReady, component)
+	} else {
+		notReady[component] = reason
+	}
+}
+
+// serveReady responds 200 when ready, and 503 with the reasons otherwise.
+func serveReady(w http.ResponseWriter, _ *http.Request) {
+	notReadyLock.Lock()
+	reasons := maps.Clone(notReady)
+	notReadyLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(reasons) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	res := struct {
+		Ready   bool              `json:"ready"`
+		Reasons map[string]string `json:"reasons,omitempty"`
+	}{len(reasons) == 0, reasons}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.Error("Serving GET /ready", "err", err)
+	}
+}
+
+func init() {
+	registerStats("notReady", func() any {
+		notReadyLock.Lock()
+		defer notReadyLock.Unlock()
+		return slices.Sorted(maps.Keys(notReady))
+	})
+}
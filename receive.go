@@ -2,14 +2,21 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -19,6 +26,12 @@ type receiver interface {
 	Start()
 }
 
+// listeningReceiver is a receiver that binds a port, which Listen does before Start is called.
+type listeningReceiver interface {
+	receiver
+	Listen() error
+}
+
 // Example values:
 // heartRate:80
 // stepCount:80
@@ -26,19 +39,135 @@ type receiver interface {
 // speed:0.8606014661155669
 // calories:7
 type healthData struct {
-	Time             time.Time `json:"time"`
-	HeartRate        int       `json:"heartRate"`
-	StepCount        int       `json:"stepCount"`
-	DistanceTraveled float64   `json:"distanceTraveled"`
-	Speed            float64   `json:"speed"`
-	Calories         int       `json:"calories"`
+	Time      time.Time `json:"time"`
+	HeartRate int       `json:"heartRate"`
+	// HeartRatePrecise keeps the fractional BPM with -hr-precise, see HeartRateValue
+	HeartRatePrecise float64 `json:"-"`
+	StepCount        int     `json:"stepCount"`
+	DistanceTraveled float64 `json:"distanceTraveled"`
+	Speed            float64 `json:"speed"`
+	Calories         int     `json:"calories"`
+
+	// HRVEstimate is the approximate heart rate variability in ms, set by hrvEstimator
+	HRVEstimate float64 `json:"hrvEstimate"`
+	// HeartRateWindow is the heart rate over the last -stats-window, set by hrWindowAggregator if enabled
+	HeartRateWindow *hrWindowStats `json:"heartRateWindow,omitempty"`
+
+	// KeyTimes is when each field was last updated, while Time is for any field
+	KeyTimes keyTimes `json:"keyTimes"`
+
+	// SessionStart is the time of the first data after a gap longer than sessionGap
+	SessionStart time.Time `json:"-"`
+}
+
+// keyTimes holds the last update time of each healthData field.
+type keyTimes struct {
+	HeartRate        time.Time `json:"heartRate"`
+	StepCount        time.Time `json:"stepCount"`
+	DistanceTraveled time.Time `json:"distanceTraveled"`
+	Speed            time.Time `json:"speed"`
+	Calories         time.Time `json:"calories"`
+}
+
+func (k *keyTimes) field(key string) *time.Time {
+	switch key {
+	case "heartRate":
+		return &k.HeartRate
+	case "stepCount":
+		return &k.StepCount
+	case "distanceTraveled":
+		return &k.DistanceTraveled
+	case "speed":
+		return &k.Speed
+	case "calories":
+		return &k.Calories
+	default:
+		return nil
+	}
+}
+
+// Get returns when the field identified by key was last updated, or the zero time.
+func (k *keyTimes) Get(key string) time.Time {
+	if t := k.field(key); t != nil {
+		return *t
+	}
+	return time.Time{}
+}
+
+// sessionGap is how long data may be absent before a new session starts. Set from the -session-gap flag.
+var sessionGap = 5 * time.Minute
+
+// SessionDuration returns the elapsed time of the current session, based on data timestamps.
+func (d *healthData) SessionDuration() time.Duration {
+	if d.SessionStart.IsZero() {
+		return 0
+	}
+	return d.Time.Sub(d.SessionStart)
+}
+
+// preciseHeartRate keeps the fractional heart rate in HeartRatePrecise. Set from the -hr-precise flag.
+var preciseHeartRate bool
+
+// setHeartRate sets the heart rate, truncated to whole BPM unless preciseHeartRate is set.
+func (d *healthData) setHeartRate(value float64) {
+	if !preciseHeartRate {
+		value = math.Trunc(value)
+	}
+	d.HeartRate, d.HeartRatePrecise = int(value), value
+}
+
+// HeartRateValue returns the heart rate at full precision. Data decoded without
+// HeartRatePrecise, e.g. from MessagePack, falls back to the whole BPM.
+func (d *healthData) HeartRateValue() float64 {
+	if int(d.HeartRatePrecise) != d.HeartRate {
+		return float64(d.HeartRate)
+	}
+	return d.HeartRatePrecise
+}
+
+// imperialUnits additionally exposes imperial derived values. Set from the -units flag.
+var imperialUnits bool
+
+// SpeedKmh returns the speed converted from m/s to km/h.
+func (d *healthData) SpeedKmh() float64 {
+	return d.Speed * 3.6
+}
+
+// SpeedMph returns the speed converted from m/s to mph.
+func (d *healthData) SpeedMph() float64 {
+	return d.Speed * 3600 / 1609.344
+}
+
+// healthDataKeys lists the keys accepted by healthData.Update, in field order.
+var healthDataKeys = []string{"heartRate", "stepCount", "distanceTraveled", "speed", "calories"}
+
+// Get returns the value of the field identified by key.
+func (d *healthData) Get(key string) (float64, bool) {
+	switch key {
+	case "heartRate":
+		return d.HeartRateValue(), true
+	case "stepCount":
+		return float64(d.StepCount), true
+	case "distanceTraveled":
+		return d.DistanceTraveled, true
+	case "speed":
+		return d.Speed, true
+	case "calories":
+		return float64(d.Calories), true
+	default:
+		return 0, false
+	}
 }
 
 func (d *healthData) Update(key string, value float64) {
-	d.Time = time.Now()
+	now := time.Now()
+	if d.SessionStart.IsZero() || now.Sub(d.Time) > sessionGap || sessionResetSince(d.SessionStart) {
+		d.SessionStart = now
+	}
+	d.Time = now
 	switch key {
 	case "heartRate":
-		d.HeartRate = int(value)
+		d.setHeartRate(value)
 	case "stepCount":
 		d.StepCount = int(value)
 	case "distanceTraveled":
@@ -49,27 +178,171 @@ func (d *healthData) Update(key string, value float64) {
 		d.Calories = int(value)
 	default:
 		slog.Warn("Unknown key", "key", key)
+		return
+	}
+	*d.KeyTimes.field(key) = now
+}
+
+// copyField sets the field identified by key, and its update time, to those of from.
+func (d *healthData) copyField(from healthData, key string) {
+	switch key {
+	case "heartRate":
+		d.HeartRate, d.HeartRatePrecise = from.HeartRate, from.HeartRatePrecise
+	case "stepCount":
+		d.StepCount = from.StepCount
+	case "distanceTraveled":
+		d.DistanceTraveled = from.DistanceTraveled
+	case "speed":
+		d.Speed = from.Speed
+	case "calories":
+		d.Calories = from.Calories
+	default:
+		return
 	}
+	*d.KeyTimes.field(key) = from.KeyTimes.Get(key)
 }
 
 type hdsReceiver struct {
 	exporters []exporter
+	maxBody   int64
+	listener  net.Listener
 	data      healthData
+
+	// dedupWindow, if non-zero, is how long a payload identical to the previous one is ignored
+	dedupWindow time.Duration
+	dedupLock   sync.Mutex
+	lastPayload string
+	lastTime    time.Time
+
+	// tap, if set, receives every raw payload before parsing
+	tap     io.Writer
+	tapLock sync.Mutex
+
+	// jsonErrors responds with hdsError bodies instead of plain text
+	jsonErrors bool
+	// snapshotResponse responds with the updated data to clients accepting JSON, instead of an empty body
+	snapshotResponse bool
+	// pathMap maps request paths to the field keys their bare value bodies update
+	pathMap map[string]string
+	// injectToken, if set, enables POST /inject authenticated with it
+	injectToken string
 }
 
-func newHDSReceiver(exporters []exporter) *hdsReceiver {
+func newHDSReceiver(exporters []exporter, maxBody int64, dedupWindow time.Duration, tap io.Writer, jsonErrors, snapshotResponse bool, pathMap map[string]string, injectToken string) *hdsReceiver {
 	return &hdsReceiver{
-		exporters: exporters,
+		exporters:        exporters,
+		maxBody:          maxBody,
+		dedupWindow:      dedupWindow,
+		tap:              tap,
+		jsonErrors:       jsonErrors,
+		snapshotResponse: snapshotResponse,
+		pathMap:          pathMap,
+		injectToken:      injectToken,
+	}
+}
+
+// parseHDSPathMap parses "/heartRate=heartRate,/steps=stepCount" style mappings.
+func parseHDSPathMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
 	}
+	for _, pair := range strings.Split(s, ",") {
+		path, key, ok := strings.Cut(pair, "=")
+		if !ok || !strings.HasPrefix(path, "/") || path == "/" || strings.ContainsAny(path, " {}") {
+			return nil, fmt.Errorf("invalid path mapping %q", pair)
+		}
+		if !slices.Contains(healthDataKeys, key) {
+			return nil, fmt.Errorf("%s: unknown field %q", path, key)
+		}
+		m[path] = key
+	}
+	return m, nil
+}
+
+// Machine-readable codes of hdsError
+const (
+	hdsErrInvalidGzip   = "invalid_gzip"
+	hdsErrBodyTooLarge  = "body_too_large"
+	hdsErrInvalidBody   = "invalid_body"
+	hdsErrInvalidFormat = "invalid_format"
+	hdsErrInvalidValue  = "invalid_value"
+	hdsErrEmptyValue    = "empty_value"
+)
+
+// hdsError is the JSON error response body, with -hds-json-errors.
+type hdsError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// writeError responds with msg and status, as plain text or as an hdsError with code.
+func (h *hdsReceiver) writeError(w http.ResponseWriter, code, msg string, status int) {
+	if !h.jsonErrors {
+		http.Error(w, msg, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(hdsError{Error: msg, Code: code}); err != nil {
+		slog.Error("Writing error response", "err", err)
+	}
+}
+
+// writeTap records payload as a line of the receive time and the quoted payload.
+func (h *hdsReceiver) writeTap(payload string) {
+	if h.tap == nil {
+		return
+	}
+	h.tapLock.Lock()
+	defer h.tapLock.Unlock()
+	line := time.Now().Format(time.RFC3339Nano) + "\t" + strconv.Quote(payload) + "\n"
+	if _, err := io.WriteString(h.tap, line); err != nil {
+		slog.Error("Writing HDS tap", "err", err)
+	}
+}
+
+// isDuplicate reports whether payload repeats the previous one within the dedup window.
+func (h *hdsReceiver) isDuplicate(payload string) bool {
+	if h.dedupWindow == 0 {
+		return false
+	}
+	h.dedupLock.Lock()
+	defer h.dedupLock.Unlock()
+	now := time.Now()
+	if payload == h.lastPayload && now.Sub(h.lastTime) < h.dedupWindow {
+		return true
+	}
+	h.lastPayload, h.lastTime = payload, now
+	return false
+}
+
+func (h *hdsReceiver) Listen() error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(*hdsPort))
+	if err != nil {
+		return err
+	}
+	h.listener = listener
+	return nil
 }
 
 func (h *hdsReceiver) Start() {
 	// See: https://github.com/Rexios80/hds_desktop/blob/master/bin/hds_desktop.dart
 	mux := http.NewServeMux()
 	mux.Handle("PUT /", http.HandlerFunc(h.dataHandler))
+	// Same as PUT, for clients (e.g. webhook tools) that can only POST
+	mux.Handle("POST /", http.HandlerFunc(h.dataHandler))
+	for path, key := range h.pathMap {
+		mux.Handle("PUT "+path, h.pathHandler(key))
+		mux.Handle("POST "+path, h.pathHandler(key))
+	}
+	if h.injectToken != "" {
+		mux.Handle("POST /inject", tokenAuth(h.injectToken, http.HandlerFunc(h.injectHandler)))
+	}
 
 	slog.Info("HDS Receiver listening...", "port", *hdsPort)
-	if err := http.ListenAndServe(":"+strconv.Itoa(*hdsPort), mux); err != nil {
+	if err := http.Serve(h.listener, mux); err != nil {
 		slog.Error(err.Error())
 	}
 }
@@ -79,54 +352,259 @@ type hdsRequest struct {
 }
 
 func (h *hdsReceiver) dataHandler(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, h.maxBody)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			slog.Error("error decompressing request", "err", err)
+			h.writeError(w, hdsErrInvalidGzip, "Invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		// Limit the decompressed size too, to guard against zip bombs
+		body = http.MaxBytesReader(w, gz, h.maxBody)
+	}
+
 	var data hdsRequest
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+	if err := json.NewDecoder(body).Decode(&data); err != nil {
 		slog.Error("error decoding request", "err", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.writeError(w, hdsErrBodyTooLarge, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.writeError(w, hdsErrInvalidBody, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	slog.Info("Received hds req", "data", data.Data)
-	parts := strings.Split(data.Data, ":")
-	if len(parts) != 2 {
-		slog.Error("Invalid data format", "data", data.Data)
-		http.Error(w, "Invalid data format", http.StatusBadRequest)
+	h.handlePayload(w, r, data.Data)
+}
+
+// pathHandler accepts a bare value as body, for the field key mapped to the request path.
+func (h *hdsReceiver) pathHandler(key string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBody))
+		if err != nil {
+			slog.Error("error reading request", "err", err)
+			h.writeError(w, hdsErrBodyTooLarge, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.handlePayload(w, r, key+":"+strings.TrimSpace(string(body)))
+	}
+}
+
+// handlePayload applies an HDS "key:value" payload and responds.
+func (h *hdsReceiver) handlePayload(w http.ResponseWriter, r *http.Request, payload string) {
+	slog.Info("Received hds req", "data", payload)
+	h.writeTap(payload)
+	if h.isDuplicate(payload) {
+		// Still acknowledge, so that the source does not retry again
+		countDropped(dropStageDedup)
+		slog.Debug("Ignoring duplicate hds req", "data", payload)
+		h.writeOK(w, r, h.data)
+		return
+	}
+	key, value, err := parseKeyValue(payload)
+	if errors.Is(err, errInvalidFormat) {
+		slog.Error("Invalid data format", "data", payload)
+		h.writeError(w, hdsErrInvalidFormat, "Invalid data format", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errEmptyValue) {
+		slog.Error("Empty value", "data", payload)
+		h.writeError(w, hdsErrEmptyValue, "Empty value for "+key, http.StatusBadRequest)
 		return
 	}
-	key, valueStr := parts[0], parts[1]
-	value, err := strconv.ParseFloat(valueStr, 64)
 	if err != nil {
-		slog.Error("Error parsing value", "value", valueStr)
-		http.Error(w, "Invalid value format", http.StatusBadRequest)
+		slog.Error("Error parsing value", "data", payload)
+		h.writeError(w, hdsErrInvalidValue, "Invalid value format", http.StatusBadRequest)
 		return
 	}
 	h.data.Update(key, value)
+	receivedUpdates.Inc("hds")
+
+	h.writeOK(w, r, h.data)
+
+	sendToExporters(h.exporters, h.data, key)
+}
+
+// injectRequest is the body of POST /inject.
+type injectRequest struct {
+	Key   string  `json:"key"`
+	Value float64 `json:"value"`
+}
+
+// injectHandler applies a value as if received from the source, for testing with -debug-inject.
+func (h *hdsReceiver) injectHandler(w http.ResponseWriter, r *http.Request) {
+	var req injectRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBody)).Decode(&req); err != nil {
+		h.writeError(w, hdsErrInvalidBody, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(healthDataKeys, req.Key) {
+		h.writeError(w, hdsErrInvalidFormat, "Unknown key "+req.Key, http.StatusBadRequest)
+		return
+	}
+	slog.Warn("Injected value", "key", req.Key, "value", req.Value, "addr", r.RemoteAddr)
+	h.data.Update(req.Key, req.Value)
+	receivedUpdates.Inc("inject")
+
+	h.writeOK(w, r, h.data)
 
+	sendToExporters(h.exporters, h.data, req.Key)
+}
+
+// writeOK acknowledges a request, with data as body if enabled and the client accepts JSON.
+func (h *hdsReceiver) writeOK(w http.ResponseWriter, r *http.Request, data healthData) {
+	if !h.snapshotResponse || !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		slog.Error("Writing hds snapshot response", "err", err)
+	}
+}
+
+var (
+	errInvalidFormat = errors.New("invalid data format")
+	errInvalidValue  = errors.New("invalid value format")
+	errEmptyValue    = errors.New("empty value")
+)
+
+// parseKeyValue parses the HDS "key:value" data format, ignoring spaces around the key and value.
+// An empty value, e.g. "heartRate:", returns the key with errEmptyValue.
+func parseKeyValue(s string) (key string, value float64, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return "", 0, errInvalidFormat
+	}
+	key, valueStr := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if valueStr == "" {
+		return key, 0, errEmptyValue
+	}
+	value, err = strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", errInvalidValue, err)
+	}
+	return key, value, nil
+}
 
-	for _, s := range h.exporters {
-		if err = s.Update(h.data, key); err != nil {
+// decodeUpdate accepts either a wsUpdateMessage JSON or the HDS "key:value" format.
+// state holds the data built from previous "key:value" messages and is updated in place.
+func decodeUpdate(payload []byte, state *healthData) (healthData, string, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(payload), []byte("{")) {
+		var msg wsUpdateMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return healthData{}, "", err
+		}
+		*state = msg.Data
+		return msg.Data, msg.UpdatedKey, nil
+	}
+
+	key, value, err := parseKeyValue(string(payload))
+	if err != nil {
+		return healthData{}, "", err
+	}
+	state.Update(key, value)
+	return *state, key, nil
+}
+
+// sendToExporters passes updated data to all exporters, logging any errors.
+// It returns the number of exporters that failed.
+func sendToExporters(exporters []exporter, data healthData, updatedKey string) (failed int) {
+	for _, s := range exporters {
+		if err := s.Update(data, updatedKey); err != nil {
+			failed++
+			countDropped(dropStageExporter)
 			slog.Error("Sending data", "err", err)
 		}
 	}
+	return failed
+}
+
+// reconnector repeatedly calls a connect function, sleeping between attempts.
+// Failed attempts back off exponentially from firstWait, while clean returns wait cleanWait
+// and reset the backoff. Waits are jittered by up to reconnectJitter, so that clients do not
+// reconnect in lockstep.
+type reconnector struct {
+	// cleanWait defaults to firstWait
+	cleanWait   time.Duration
+	firstWait   time.Duration
+	maxBackoff  time.Duration
+	nextBackoff time.Duration
+}
+
+func newReconnector(firstWait, maxBackoff time.Duration) *reconnector {
+	return &reconnector{
+		cleanWait:   firstWait,
+		firstWait:   firstWait,
+		maxBackoff:  maxBackoff,
+		nextBackoff: firstWait,
+	}
+}
+
+const reconnectJitter = 0.1
+
+func (r *reconnector) run(name string, connect func() error) {
+	r.runUntil(context.Background(), name, connect)
+}
+
+// runUntil is run, returning once ctx is done instead of reconnecting.
+func (r *reconnector) runUntil(ctx context.Context, name string, connect func() error) {
+	for {
+		err := connect()
+		if ctx.Err() != nil {
+			return
+		}
+		wait := r.next(err)
+		if err != nil {
+			slog.Error(name+" connection", "err", err)
+			slog.Error("Reconnecting in", "duration", wait)
+		} else {
+			slog.Info("Reconnecting in", "duration", wait)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// next returns the wait before the upcoming attempt, given the result of the last one.
+func (r *reconnector) next(err error) time.Duration {
+	var wait time.Duration
+	if err == nil {
+		r.nextBackoff = r.firstWait
+		wait = r.cleanWait
+	} else {
+		wait = r.nextBackoff
+		r.nextBackoff = min(r.nextBackoff*2, r.maxBackoff)
+	}
+	return wait + time.Duration(rand.Float64()*reconnectJitter*float64(wait))
 }
 
 type wsPullReceiver struct {
 	exporters   []exporter
 	addr        string
-	nextBackoff time.Duration
+	reconnector *reconnector
+	// bufferSize, if non-zero, queues up to this many messages between reading and the exporters
+	bufferSize int
 }
 
-const (
-	wsPullFirstWait  = time.Second
-	wsPullMaxBackoff = 10 * time.Minute
-)
-
-func newWSPullReceiver(exporters []exporter, addr string) *wsPullReceiver {
+// newWSPullReceiver creates a receiver reconnecting after cleanWait when the server closed the
+// connection cleanly, e.g. when cycling, and backing off exponentially from firstWait up to
+// maxBackoff after errors.
+func newWSPullReceiver(exporters []exporter, addr string, bufferSize int, cleanWait, firstWait, maxBackoff time.Duration) *wsPullReceiver {
+	r := newReconnector(firstWait, maxBackoff)
+	r.cleanWait = cleanWait
 	return &wsPullReceiver{
 		exporters:   exporters,
 		addr:        addr,
-		nextBackoff: wsPullFirstWait,
+		reconnector: r,
+		bufferSize:  bufferSize,
 	}
 }
 
@@ -137,46 +615,84 @@ func (h *wsPullReceiver) connect() error {
 	}
 	defer c.Close()
 
+	// Exporters are called inline, or with a buffer from their own goroutine so that slow
+	// exporters do not stall reading. Messages still queued are sent before returning.
+	send := func(msg wsUpdateMessage) {
+		sendToExporters(h.exporters, msg.Data, msg.UpdatedKey)
+	}
+	if h.bufferSize > 0 {
+		queue := make(chan wsUpdateMessage, h.bufferSize)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for msg := range queue {
+				sendToExporters(h.exporters, msg.Data, msg.UpdatedKey)
+			}
+		}()
+		defer func() {
+			close(queue)
+			<-done
+		}()
+		send = func(msg wsUpdateMessage) {
+			enqueueLatest(queue, msg)
+		}
+	}
+
 	slog.Info("WebSocket connected, now receiving messages...")
 	for {
-		_, rawMsg, err := c.ReadMessage()
-		if errors.Is(err, io.EOF) {
+		msgType, rawMsg, err := c.ReadMessage()
+		// The reader reports close frames as errors, not io.EOF
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			slog.Info("WebSocket closed by server", "err", err)
 			return nil
 		}
 		if err != nil {
 			return fmt.Errorf("reading websocket: %v", err)
 		}
 
-		var msg wsUpdateMessage
-		if err = json.NewDecoder(bytes.NewReader(rawMsg)).Decode(&msg); err != nil {
+		msg, err := decodeUpdateMessage(rawMsg, msgType == websocket.BinaryMessage)
+		if err != nil {
 			return fmt.Errorf("decoding websocket message: %v", err)
 		}
 		slog.Info("Received msg", "updatedKey", msg.UpdatedKey, "data", msg.Data)
+		receivedUpdates.Inc("ws-pull")
 
-		for _, s := range h.exporters {
-			if err = s.Update(msg.Data, msg.UpdatedKey); err != nil {
-				slog.Error("Sending data", "err", err)
-			}
-		}
+		send(msg)
 	}
 }
 
-func (h *wsPullReceiver) Start() {
+// enqueueLatest queues msg, dropping the oldest queued messages while the queue is full.
+// msg carries the latest data, but becomes an "all" update if a dropped one was for another key.
+func enqueueLatest(queue chan wsUpdateMessage, msg wsUpdateMessage) {
 	for {
-		err := h.connect()
-		if err != nil {
-			slog.Error("WebSocket connection", "err", err)
+		select {
+		case queue <- msg:
+			return
+		default:
 		}
-
-		// Sleep before reconnecting
-		if err == nil {
-			h.nextBackoff = wsPullFirstWait
-			slog.Info("Reconnecting in", "duration", h.nextBackoff)
-			time.Sleep(h.nextBackoff)
-		} else {
-			slog.Error("Reconnecting in", "duration", h.nextBackoff)
-			time.Sleep(h.nextBackoff)
-			h.nextBackoff = min(h.nextBackoff*2, wsPullMaxBackoff)
+		select {
+		case old := <-queue:
+			countDropped(dropStageThrottle)
+			if old.UpdatedKey != msg.UpdatedKey {
+				msg.UpdatedKey = "all"
+			}
+		default:
 		}
 	}
 }
+
+// decodeUpdateMessage decodes a wsUpdateMessage, as MessagePack or else JSON.
+func decodeUpdateMessage(b []byte, msgpackEncoded bool) (wsUpdateMessage, error) {
+	var msg wsUpdateMessage
+	var err error
+	if msgpackEncoded {
+		err = unmarshalMsgpack(b, &msg)
+	} else {
+		err = json.NewDecoder(bytes.NewReader(b)).Decode(&msg)
+	}
+	return msg, err
+}
+
+func (h *wsPullReceiver) Start() {
+	h.reconnector.run("WebSocket", h.connect)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// fallbackReceiver runs the primary receiver, and also starts the fallback receiver
+// once the primary supplied no data for after, or stopped. Both feed the same exporters.
+type fallbackReceiver struct {
+	primaryMode, fallbackMode string
+	primary, fallback         receiver
+	after                     time.Duration
+
+	lock            sync.Mutex
+	timer           *time.Timer
+	fallbackStarted bool
+	// supplying is the mode of the receiver that last supplied data
+	supplying string
+	// merger combines the fields supplied by both receivers
+	merger *receiveMerger
+
+	running sync.WaitGroup
+}
+
+// newFallbackReceiver creates both receivers with newReceiver, each sending to exporters.
+// With a priority, see receiveMerger, fields are taken from the preferred receiver while fresh.
+func newFallbackReceiver(primaryMode, fallbackMode string, after time.Duration, priority []string, exporters []exporter, newReceiver func(mode string, exporters []exporter) receiver) *fallbackReceiver {
+	f := &fallbackReceiver{
+		primaryMode:  primaryMode,
+		fallbackMode: fallbackMode,
+		after:        after,
+		merger:       &receiveMerger{priority: priority, latest: map[string]healthData{}},
+	}
+	f.primary = newReceiver(primaryMode, []exporter{&receiveSource{f: f, mode: primaryMode, next: exporters}})
+	f.fallback = newReceiver(fallbackMode, []exporter{&receiveSource{f: f, mode: fallbackMode, next: exporters}})
+	return f
+}
+
+// Listen binds the primary receiver only, the fallback binds when it is started.
+func (f *fallbackReceiver) Listen() error {
+	if l, ok := f.primary.(listeningReceiver); ok {
+		return l.Listen()
+	}
+	return nil
+}
+
+func (f *fallbackReceiver) Start() {
+	f.lock.Lock()
+	f.timer = time.AfterFunc(f.after, func() {
+		slog.Warn("No data from primary receiver, starting fallback", "primary", f.primaryMode, "fallback", f.fallbackMode, "after", f.after)
+		f.startFallback()
+	})
+	f.lock.Unlock()
+
+	f.running.Add(1)
+	go func() {
+		defer f.running.Done()
+		f.primary.Start()
+		slog.Error("Primary receiver stopped, starting fallback", "primary", f.primaryMode, "fallback", f.fallbackMode)
+		f.startFallback()
+	}()
+	f.running.Wait()
+}
+
+func (f *fallbackReceiver) startFallback() {
+	f.lock.Lock()
+	if f.fallbackStarted {
+		f.lock.Unlock()
+		return
+	}
+	f.fallbackStarted = true
+	f.timer.Stop()
+	f.lock.Unlock()
+
+	if l, ok := f.fallback.(listeningReceiver); ok {
+		if err := l.Listen(); err != nil {
+			slog.Error("Fallback receiver listen", "receiver", f.fallbackMode, "err", err)
+			return
+		}
+	}
+	f.running.Add(1)
+	go func() {
+		defer f.running.Done()
+		f.fallback.Start()
+	}()
+}
+
+// supplied records that the receiver of mode supplied an update.
+func (f *fallbackReceiver) supplied(mode string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if mode == f.primaryMode && !f.fallbackStarted {
+		f.timer.Reset(f.after)
+	}
+	if f.supplying != mode {
+		slog.Info("Receiving data", "receiver", mode, "previous", f.supplying)
+		f.supplying = mode
+	}
+}
+
+// receiveSource passes updates of one receiver on, noting it as their source.
+type receiveSource struct {
+	f    *fallbackReceiver
+	mode string
+	next []exporter
+}
+
+func (s *receiveSource) Update(data healthData, updatedKey string) error {
+	s.f.supplied(s.mode)
+	data, ok := s.f.merger.merge(s.mode, data, updatedKey)
+	if !ok {
+		countDropped(dropStagePriority)
+		return nil
+	}
+	sendToExporters(s.next, data, updatedKey)
+	return nil
+}
+
+// receiveMerger combines the data of several receivers into one value per field, so that a field
+// one receiver never supplied does not alternate downstream with the value of the other, which
+// counters would see as resets. Without a priority, each field keeps its last update from either.
+//
+// With a priority, each field comes from the receiver earliest in priority whose value for it is
+// fresh, i.e. updated within -data-ttl, and modes not listed come last. Freshness is per field:
+// a lower priority receiver supplies a field only while no higher one updated it recently, and
+// takes over once their value is stale, even if they still send other fields.
+type receiveMerger struct {
+	priority []string
+
+	lock   sync.Mutex
+	latest map[string]healthData
+	merged healthData
+}
+
+func (m *receiveMerger) rank(mode string) int {
+	if i := slices.Index(m.priority, mode); i >= 0 {
+		return i
+	}
+	return len(m.priority)
+}
+
+// source returns the mode supplying key by priority, or false if no receiver has a fresh value for it.
+func (m *receiveMerger) source(key string) (string, bool) {
+	if len(m.priority) == 0 {
+		return "", false
+	}
+	best, found := "", false
+	for mode, data := range m.latest {
+		if t := data.KeyTimes.Get(key); t.IsZero() || isStale(t) {
+			continue
+		}
+		if !found || m.rank(mode) < m.rank(best) {
+			best, found = mode, true
+		}
+	}
+	return best, found
+}
+
+// merge records data from the receiver of mode, and returns the merged data of all receivers.
+// It returns false if updatedKey is supplied by a higher priority receiver, dropping the update.
+func (m *receiveMerger) merge(mode string, data healthData, updatedKey string) (healthData, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.latest[mode] = data
+	if src, ok := m.source(updatedKey); ok && src != mode {
+		return healthData{}, false
+	}
+
+	for _, key := range healthDataKeys {
+		if src, ok := m.source(key); ok {
+			m.merged.copyField(m.latest[src], key)
+		} else if data.KeyTimes.Get(key).After(m.merged.KeyTimes.Get(key)) {
+			m.merged.copyField(data, key)
+		}
+	}
+	// Sessions follow the merged data, as in healthData.Update
+	if m.merged.SessionStart.IsZero() || data.Time.Sub(m.merged.Time) > sessionGap || sessionResetSince(m.merged.SessionStart) {
+		m.merged.SessionStart = data.SessionStart
+	}
+	if data.Time.After(m.merged.Time) {
+		m.merged.Time = data.Time
+	}
+	return m.merged, true
+}
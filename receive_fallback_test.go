@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// counterExporter feeds the step and calorie counters as the Prometheus exporter does.
+type counterExporter struct {
+	steps, calories monotonicCounter
+}
+
+func (c *counterExporter) Update(data healthData, _ string) error {
+	c.steps.Update(float64(data.StepCount))
+	c.calories.Update(float64(data.Calories))
+	return nil
+}
+
+func TestFallbackReceiverAlternatingSourcesKeepCounters(t *testing.T) {
+	for _, priority := range [][]string{nil, {"hds", "ws-pull"}} {
+		counters := &counterExporter{}
+		sources := map[string]exporter{}
+		f := newFallbackReceiver("hds", "ws-pull", time.Minute, priority, []exporter{counters}, func(mode string, exporters []exporter) receiver {
+			sources[mode] = exporters[0]
+			return nil
+		})
+		// Both receivers are running, so the primary does not reset the fallback timer
+		f.fallbackStarted = true
+
+		// The primary only supplies the heart rate, the fallback the counters
+		var primary, fallback healthData
+		steps := []int{100, 150, 230}
+		for i, s := range steps {
+			fallback.Update("stepCount", float64(s))
+			fallback.Update("calories", float64(s/10))
+			if err := sources["ws-pull"].Update(fallback, "calories"); err != nil {
+				t.Fatal(err)
+			}
+			primary.Update("heartRate", float64(80+i))
+			if err := sources["hds"].Update(primary, "heartRate"); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := counters.steps.Total(), float64(s); got != want {
+				t.Errorf("priority %v, step %d: steps total = %v, want %v", priority, i, got, want)
+			}
+			if got, want := counters.calories.Total(), float64(s/10); got != want {
+				t.Errorf("priority %v, step %d: calories total = %v, want %v", priority, i, got, want)
+			}
+		}
+	}
+}
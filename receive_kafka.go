@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type kafkaReceiver struct {
+	// ctx stops consuming once done
+	ctx         context.Context
+	exporters   []exporter
+	readerCfg   kafka.ReaderConfig
+	reconnector *reconnector
+
+	// data holds the state built from "key:value" messages
+	data healthData
+}
+
+const (
+	kafkaConsumeFirstWait  = time.Second
+	kafkaConsumeMaxBackoff = 10 * time.Minute
+)
+
+func newKafkaReceiver(ctx context.Context, exporters []exporter, brokers []string, topic, group string) *kafkaReceiver {
+	return &kafkaReceiver{
+		ctx:       ctx,
+		exporters: exporters,
+		readerCfg: kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   topic,
+			GroupID: group,
+			// Commit explicitly after each dispatch
+			CommitInterval: 0,
+		},
+		reconnector: newReconnector(kafkaConsumeFirstWait, kafkaConsumeMaxBackoff),
+	}
+}
+
+func (k *kafkaReceiver) connect() error {
+	ctx := k.ctx
+	// The reader joins the consumer group and follows rebalances by itself
+	reader := kafka.NewReader(k.readerCfg)
+	defer reader.Close()
+
+	slog.Info("Kafka consumer started, now receiving messages...", "topic", k.readerCfg.Topic, "group", k.readerCfg.GroupID)
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("fetching kafka message: %v", err)
+		}
+
+		data, updatedKey, err := decodeUpdate(msg.Value, &k.data)
+		if err != nil {
+			slog.Error("Decoding kafka message", "offset", msg.Offset, "err", err)
+		} else {
+			slog.Info("Received msg", "updatedKey", updatedKey, "data", data)
+			receivedUpdates.Inc("kafka")
+			if failed := sendToExporters(k.exporters, data, updatedKey); failed > 0 {
+				// Not committed, so that the group redelivers it to the reader recreated on reconnect
+				return fmt.Errorf("dispatching kafka message at offset %d: %d exporters failed", msg.Offset, failed)
+			}
+		}
+
+		// Commit only after the message has been dispatched (or is known to be undecodable)
+		if err = reader.CommitMessages(ctx, msg); err != nil {
+			return fmt.Errorf("committing kafka offset: %v", err)
+		}
+	}
+}
+
+// Start consumes until ctx is done, reconnecting after failures.
+func (k *kafkaReceiver) Start() {
+	k.reconnector.runUntil(k.ctx, "Kafka", k.connect)
+	slog.Info("Kafka consumer stopped")
+}
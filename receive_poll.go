@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// pollReceiver repeatedly GETs update messages over plain HTTP, for networks blocking WebSockets.
+// With a long-polling server each request waits until the next update, otherwise interval
+// spaces the requests.
+type pollReceiver struct {
+	exporters   []exporter
+	url         string
+	interval    time.Duration
+	client      *http.Client
+	reconnector *reconnector
+}
+
+const (
+	pollFirstWait  = time.Second
+	pollMaxBackoff = 10 * time.Minute
+	// pollTimeout bounds a single request, long enough for long-polling servers to hold it
+	pollTimeout = 5 * time.Minute
+)
+
+func newPollReceiver(exporters []exporter, url string, interval time.Duration) *pollReceiver {
+	return &pollReceiver{
+		exporters:   exporters,
+		url:         url,
+		interval:    interval,
+		client:      &http.Client{Timeout: pollTimeout},
+		reconnector: newReconnector(pollFirstWait, pollMaxBackoff),
+	}
+}
+
+// connect polls until a request fails.
+func (p *pollReceiver) connect() error {
+	slog.Info("Polling for messages...", "url", p.url, "interval", p.interval)
+	for {
+		if err := p.poll(); err != nil {
+			return err
+		}
+		time.Sleep(p.interval)
+	}
+}
+
+func (p *pollReceiver) poll() error {
+	resp, err := p.client.Get(p.url)
+	if err != nil {
+		return fmt.Errorf("polling: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified:
+		// No update, e.g. a long-poll ending without one
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("polling: unexpected status %s", resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading poll response: %v", err)
+	}
+	msg, err := decodeUpdateMessage(b, resp.Header.Get("Content-Type") == "application/msgpack")
+	if err != nil {
+		return fmt.Errorf("decoding poll response: %v", err)
+	}
+	slog.Info("Received msg", "updatedKey", msg.UpdatedKey, "data", msg.Data)
+	receivedUpdates.Inc("poll")
+
+	sendToExporters(p.exporters, msg.Data, msg.UpdatedKey)
+	return nil
+}
+
+func (p *pollReceiver) Start() {
+	p.reconnector.run("Poll", p.connect)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisReceiver struct {
+	exporters   []exporter
+	client      *redis.Client
+	channel     string
+	reconnector *reconnector
+
+	// data holds the state built from "key:value" messages
+	data healthData
+}
+
+const (
+	redisSubFirstWait  = time.Second
+	redisSubMaxBackoff = 10 * time.Minute
+)
+
+func newRedisReceiver(exporters []exporter, addr, channel string) *redisReceiver {
+	return &redisReceiver{
+		exporters:   exporters,
+		client:      redis.NewClient(&redis.Options{Addr: addr}),
+		channel:     channel,
+		reconnector: newReconnector(redisSubFirstWait, redisSubMaxBackoff),
+	}
+}
+
+func (r *redisReceiver) connect() error {
+	ctx := context.Background()
+	sub := r.client.Subscribe(ctx, r.channel)
+	defer sub.Close()
+
+	// Wait for the subscription confirmation so connection errors surface here
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribing to redis channel: %v", err)
+	}
+
+	slog.Info("Redis subscribed, now receiving messages...", "channel", r.channel)
+	for {
+		msg, err := sub.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("receiving redis message: %v", err)
+		}
+
+		data, updatedKey, err := decodeUpdate([]byte(msg.Payload), &r.data)
+		if err != nil {
+			slog.Error("Decoding redis message", "payload", msg.Payload, "err", err)
+			continue
+		}
+		slog.Info("Received msg", "updatedKey", updatedKey, "data", data)
+		receivedUpdates.Inc("redis")
+
+		sendToExporters(r.exporters, data, updatedKey)
+	}
+}
+
+func (r *redisReceiver) Start() {
+	r.reconnector.run("Redis", r.connect)
+}
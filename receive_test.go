@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReconnectorNext(t *testing.T) {
+	errFailed := errors.New("connection refused")
+	steps := []struct {
+		err  error
+		want time.Duration
+	}{
+		{errFailed, 1 * time.Second},
+		{errFailed, 2 * time.Second},
+		{errFailed, 4 * time.Second},
+		{errFailed, 8 * time.Second},
+		{errFailed, 10 * time.Second}, // capped
+		{errFailed, 10 * time.Second},
+		{nil, 500 * time.Millisecond}, // clean return, backoff reset
+		{errFailed, 1 * time.Second},
+		{errFailed, 2 * time.Second},
+		{nil, 500 * time.Millisecond},
+		{nil, 500 * time.Millisecond},
+		{errFailed, 1 * time.Second},
+	}
+
+	r := newReconnector(time.Second, 10*time.Second)
+	r.cleanWait = 500 * time.Millisecond
+	for i, step := range steps {
+		got := r.next(step.err)
+		// The jitter adds up to reconnectJitter of the wait
+		maxWait := step.want + time.Duration(reconnectJitter*float64(step.want))
+		if got < step.want || got > maxWait {
+			t.Errorf("step %d (err %v): wait = %v, want within [%v, %v]", i, step.err, got, step.want, maxWait)
+		}
+	}
+}
+
+func TestParseKeyValue(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantKey   string
+		wantValue float64
+		wantErr   error
+	}{
+		{"heartRate:80", "heartRate", 80, nil},
+		{"  heartRate : 80.5 ", "heartRate", 80.5, nil},
+		{"distanceTraveled:\t12.5\n", "distanceTraveled", 12.5, nil},
+		{"heartRate:", "heartRate", 0, errEmptyValue},
+		{"heartRate:   ", "heartRate", 0, errEmptyValue},
+		{"heartRate80", "", 0, errInvalidFormat},
+		{"", "", 0, errInvalidFormat},
+		{"heartRate:abc", "", 0, errInvalidValue},
+		{"heartRate:80bpm", "", 0, errInvalidValue},
+		{"heartRate:80:1", "", 0, errInvalidFormat},
+		{"time:12:00:00", "", 0, errInvalidFormat},
+	}
+	for _, tt := range tests {
+		key, value, err := parseKeyValue(tt.input)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("parseKeyValue(%q) error = %v, want %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if key != tt.wantKey || value != tt.wantValue {
+			t.Errorf("parseKeyValue(%q) = %q, %v, want %q, %v", tt.input, key, value, tt.wantKey, tt.wantValue)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exporterConfig holds an exporter's settings by name. Settings mapped from flags are keyed
+// by flag name, without the exporter's name as prefix, e.g. "endpoint" for -otel-endpoint.
+type exporterConfig map[string]any
+
+func (c exporterConfig) String(key string) string {
+	v, _ := c[key].(string)
+	return v
+}
+
+func (c exporterConfig) Bool(key string) bool {
+	v, _ := c[key].(bool)
+	return v
+}
+
+func (c exporterConfig) Int(key string) int {
+	v, _ := c[key].(int)
+	return v
+}
+
+func (c exporterConfig) Float64(key string) float64 {
+	v, _ := c[key].(float64)
+	return v
+}
+
+func (c exporterConfig) Duration(key string) (time.Duration, error) {
+	d, err := time.ParseDuration(c.String(key))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", key, err)
+	}
+	return d, nil
+}
+
+// exporterEnv is shared by exporter constructors, for the components they are wired to.
+type exporterEnv struct {
+	ctx      context.Context
+	shutdown *sync.WaitGroup
+
+	// hub is the broadcaster shared by all streaming servers, see broadcaster
+	hub *broadcaster
+	// oscProfiles are the validated OSC profiles, from the flags and the config file
+	oscProfiles map[string]oscProfile
+	// Components wired to others once all exporters are created
+	wsServer *httpServerExporter
+	oscExp   *oscExporter
+	// alerters are kept to apply threshold changes on config reload
+	alerters []*hrThresholdAlerter
+}
+
+// broadcaster returns the shared broadcaster, creating it on first use.
+func (env *exporterEnv) broadcaster() *broadcaster {
+	if env.hub == nil {
+		env.hub = newBroadcaster()
+	}
+	return env.hub
+}
+
+// exporterRegistration describes an exporter that can be enabled by name.
+type exporterRegistration struct {
+	name        string
+	description string
+	// flags are mapped onto the exporter's config
+	flags []string
+	// enabled reports whether the exporter is configured to run. Defaults to the "enabled" setting.
+	enabled func(cfg exporterConfig) bool
+	// keys are the updated keys the exporter is sent, including disconnectedKey if handled.
+	// "all" updates are always sent. Defaults to "*" for every key.
+	keys []string
+	// create returns the exporter, or nil for components only serving the shared broadcaster
+	create func(env *exporterEnv, cfg exporterConfig) (exporter, error)
+}
+
+// exporterRegistry lists the exporters in registration order, which is also their update order.
+var exporterRegistry []exporterRegistration
+
+// registerExporter adds an exporter to the registry, from an init function of its file.
+func registerExporter(r exporterRegistration) {
+	if r.enabled == nil {
+		r.enabled = func(cfg exporterConfig) bool { return cfg.Bool("enabled") }
+	}
+	if r.keys == nil {
+		r.keys = []string{"*"}
+	}
+	exporterRegistry = append(exporterRegistry, r)
+}
+
+// config maps the current values of the exporter's flags onto its config.
+func (r *exporterRegistration) config() exporterConfig {
+	cfg := make(exporterConfig, len(r.flags))
+	for _, name := range r.flags {
+		f := flag.Lookup(name)
+		if f == nil {
+			panic("unknown flag " + name + " for exporter " + r.name)
+		}
+		cfg[strings.TrimPrefix(name, r.name+"-")] = f.Value.(flag.Getter).Get()
+	}
+	return cfg
+}
+
+// createExporters creates the enabled exporters. The shared broadcaster, if used, comes first.
+// Their health is reported in GET /stats.
+func createExporters(env *exporterEnv) ([]exporter, error) {
+	var exporters []*monitoredExporter
+	for _, r := range exporterRegistry {
+		cfg := r.config()
+		if !r.enabled(cfg) {
+			continue
+		}
+		e, err := r.create(env, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s exporter: %v", r.name, err)
+		}
+		if e != nil {
+			exporters = append(exporters, &monitoredExporter{name: r.name, next: e, keys: r.keys})
+		}
+	}
+	if env.hub != nil {
+		exporters = append([]*monitoredExporter{{name: "broadcaster", next: env.hub, keys: []string{"*"}}}, exporters...)
+	}
+
+	registerStats("exporters", func() any {
+		health := make([]exporterHealth, len(exporters))
+		for i, e := range exporters {
+			health[i] = e.Health()
+		}
+		return health
+	})
+	result := make([]exporter, len(exporters))
+	for i, e := range exporters {
+		result[i] = e
+	}
+	return result, nil
+}
+
+// listExporters writes the registered exporters, whether they are enabled, their flags and the keys they are sent.
+func listExporters(w io.Writer) {
+	for _, r := range exporterRegistry {
+		state := "disabled"
+		if r.enabled(r.config()) {
+			state = "enabled"
+		}
+		_, _ = fmt.Fprintf(w, "%s (%s): %s\n  flags: -%s\n  keys: %s\n", r.name, state, r.description, strings.Join(r.flags, ", -"), strings.Join(r.keys, ", "))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// resetters clear session state on POST /reset, keyed by section name. They return the state
+// before clearing, or nil if they had nothing to clear. counters also resets the bases that
+// keep exported counters increasing across source resets.
+var (
+	resetters     = map[string]func(counters bool) any{}
+	resettersLock sync.Mutex
+)
+
+// registerReset adds a section to POST /reset, cleared by f on each request.
+func registerReset(name string, f func(counters bool) any) {
+	resettersLock.Lock()
+	defer resettersLock.Unlock()
+	resetters[name] = f
+}
+
+// sessionResetAt is the time of the last POST /reset in Unix nanoseconds, before which
+// sessions are ended on the next update, see healthData.Update.
+var sessionResetAt atomic.Int64
+
+// sessionResetSince reports whether a reset happened after the session started at start.
+func sessionResetSince(start time.Time) bool {
+	return start.UnixNano() < sessionResetAt.Load()
+}
+
+// serveReset ends the current session and clears the session aggregators, with the
+// "counters=true" query parameter also resetting counter bases. It responds with the cleared state.
+func serveReset(w http.ResponseWriter, r *http.Request) {
+	var counters bool
+	if v := r.URL.Query().Get("counters"); v != "" {
+		var err error
+		counters, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid counters parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	sessionResetAt.Store(now.UnixNano())
+	cleared := map[string]any{"resetAt": now}
+	resettersLock.Lock()
+	for name, f := range resetters {
+		if state := f(counters); state != nil {
+			cleared[name] = state
+		}
+	}
+	resettersLock.Unlock()
+	slog.Info("Session reset", "counters", counters, "addr", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(cleared); err != nil {
+		slog.Error("Serving POST /reset", "err", err)
+	}
+}
+
+// counterTotals are the exported counter totals before a reset of their bases.
+type counterTotals struct {
+	StepCount        float64 `json:"stepCount"`
+	DistanceTraveled float64 `json:"distanceTraveled"`
+	Calories         float64 `json:"calories"`
+}
+
+// resetCounterBases resets the bases of the step, distance and calorie counters, so that
+// their totals restart from the current source values, and returns the totals before.
+func resetCounterBases(steps, distance, calories *monotonicCounter) counterTotals {
+	totals := counterTotals{StepCount: steps.Total(), DistanceTraveled: distance.Total(), Calories: calories.Total()}
+	steps.base, distance.base, calories.base = 0, 0, 0
+	return totals
+}
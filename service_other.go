@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// isService reports whether the process was started by the Windows service manager.
+func isService() bool {
+	return false
+}
+
+func runService(func(ctx context.Context)) {}
+
+func serviceCommand(string, []string) error {
+	return errors.New("running as a service is only supported on Windows; use systemd (Type=notify) elsewhere")
+}
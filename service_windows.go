@@ -0,0 +1,114 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "hds-osc"
+
+// isService reports whether the process was started by the Windows service manager.
+func isService() bool {
+	ok, err := svc.IsWindowsService()
+	if err != nil {
+		slog.Error("Detecting Windows service", "err", err)
+		return false
+	}
+	return ok
+}
+
+type serviceHandler struct {
+	run func(ctx context.Context)
+}
+
+func (h *serviceHandler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.run(ctx)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+// runService runs as a Windows service until the service manager stops it.
+func runService(run func(ctx context.Context)) {
+	if err := svc.Run(serviceName, &serviceHandler{run: run}); err != nil {
+		slog.Error("Running Windows service", "err", err)
+		os.Exit(1)
+	}
+}
+
+// serviceCommand installs or uninstalls the Windows service.
+// On install, args are stored as the service's command line flags.
+func serviceCommand(command string, args []string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connecting to service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	switch command {
+	case "install":
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		exe, err = filepath.Abs(exe)
+		if err != nil {
+			return err
+		}
+		s, err := m.CreateService(serviceName, exe, mgr.Config{
+			DisplayName: "hds-osc",
+			Description: "Forwards Health Data Server heart rate to OSC and other exporters",
+			StartType:   mgr.StartAutomatic,
+		}, args...)
+		if err != nil {
+			return fmt.Errorf("creating service: %v", err)
+		}
+		defer s.Close()
+		slog.Info("Service installed", "name", serviceName, "args", args)
+		return nil
+	case "uninstall":
+		s, err := m.OpenService(serviceName)
+		if err != nil {
+			return fmt.Errorf("opening service: %v", err)
+		}
+		defer s.Close()
+		if err = s.Delete(); err != nil {
+			return fmt.Errorf("deleting service: %v", err)
+		}
+		slog.Info("Service uninstalled", "name", serviceName)
+		return nil
+	default:
+		return fmt.Errorf("unknown service command %q", command)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// clockSkewDetector compares the timestamps of the data, set by the source for receivers
+// pulling from another instance or a broker, to the local receive time. Samples off by more
+// than maxSkew are warned about, and optionally re-timestamped with the receive time, so that
+// derived rates are not computed from a drifting clock.
+type clockSkewDetector struct {
+	next     []exporter
+	maxSkew  time.Duration
+	fallback bool
+
+	lock    sync.Mutex
+	skewed  bool
+	last    time.Duration
+	max     time.Duration
+	samples int
+}
+
+// clockSkewStats is the clockSkew section of GET /stats. Skews are positive for data behind local time.
+type clockSkewStats struct {
+	LastSeconds   float64 `json:"lastSeconds"`
+	MaxAbsSeconds float64 `json:"maxAbsSeconds"`
+	SkewedSamples int     `json:"skewedSamples"`
+}
+
+func newClockSkewDetector(next []exporter, maxSkew time.Duration, fallback bool) *clockSkewDetector {
+	d := &clockSkewDetector{next: next, maxSkew: maxSkew, fallback: fallback}
+	registerStats("clockSkew", d.stats)
+	return d
+}
+
+func (d *clockSkewDetector) Update(data healthData, updatedKey string) error {
+	if updatedKey == disconnectedKey {
+		sendToExporters(d.next, data, updatedKey)
+		return nil
+	}
+
+	now := time.Now()
+	skew := now.Sub(data.Time)
+	skewed := max(skew, -skew) > d.maxSkew
+
+	d.lock.Lock()
+	d.last = skew
+	d.max = max(d.max, skew, -skew)
+	if skewed {
+		d.samples++
+	}
+	changed := skewed != d.skewed
+	d.skewed = skewed
+	d.lock.Unlock()
+
+	// Logged on changes only, as a drifting clock skews every sample
+	if changed && skewed {
+		slog.Warn("Data timestamp skewed from local clock", "skew", skew, "max", d.maxSkew, "fallback", d.fallback)
+	} else if changed {
+		slog.Info("Data timestamp back in sync with local clock", "skew", skew)
+	}
+
+	if skewed && d.fallback {
+		data.Time = now
+		for _, key := range healthDataKeys {
+			if t := data.KeyTimes.field(key); key == updatedKey || (updatedKey == "all" && !t.IsZero()) {
+				*t = now
+			}
+		}
+	}
+	sendToExporters(d.next, data, updatedKey)
+	return nil
+}
+
+func (d *clockSkewDetector) stats() any {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return clockSkewStats{
+		LastSeconds:   d.last.Seconds(),
+		MaxAbsSeconds: d.max.Seconds(),
+		SkewedSamples: d.samples,
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statsProviders contribute sections to the GET /stats response, keyed by section name.
+var (
+	statsProviders     = map[string]func() any{}
+	statsProvidersLock sync.Mutex
+)
+
+// registerStats adds a section to GET /stats, computed by f on each request.
+func registerStats(name string, f func() any) {
+	statsProvidersLock.Lock()
+	defer statsProvidersLock.Unlock()
+	statsProviders[name] = f
+}
+
+func serveStats(w http.ResponseWriter, _ *http.Request) {
+	statsProvidersLock.Lock()
+	stats := make(map[string]any, len(statsProviders))
+	for name, f := range statsProviders {
+		stats[name] = f()
+	}
+	statsProvidersLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		slog.Error("Serving GET /stats", "err", err)
+	}
+}
+
+// counterSet counts events per label value. The initial values are reported even before
+// counting, others are added when first counted, e.g. OSC addresses.
+type counterSet struct {
+	lock   sync.RWMutex
+	values []string
+	counts map[string]*atomic.Uint64
+}
+
+func newCounterSet(values ...string) *counterSet {
+	c := &counterSet{values: values, counts: make(map[string]*atomic.Uint64, len(values))}
+	for _, v := range values {
+		c.counts[v] = &atomic.Uint64{}
+	}
+	return c
+}
+
+func (c *counterSet) Inc(value string) {
+	c.lock.RLock()
+	count, ok := c.counts[value]
+	c.lock.RUnlock()
+	if !ok {
+		c.lock.Lock()
+		if count, ok = c.counts[value]; !ok {
+			count = &atomic.Uint64{}
+			c.counts[value] = count
+			c.values = append(c.values, value)
+		}
+		c.lock.Unlock()
+	}
+	count.Add(1)
+}
+
+// Totals returns the current counts, for GET /stats.
+func (c *counterSet) Totals() any {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	totals := make(map[string]uint64, len(c.counts))
+	for v, count := range c.counts {
+		totals[v] = count.Load()
+	}
+	return totals
+}
+
+// counterSetCollector exposes a counterSet as a Prometheus counter labeled by value.
+type counterSetCollector struct {
+	desc *prometheus.Desc
+	set  *counterSet
+}
+
+func newCounterSetCollector(set *counterSet, namespace, name, help, label string) *counterSetCollector {
+	return &counterSetCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, []string{label}, nil),
+		set:  set,
+	}
+}
+
+func (c *counterSetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *counterSetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.set.lock.RLock()
+	defer c.set.lock.RUnlock()
+	for _, v := range c.set.values {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(c.set.counts[v].Load()), v)
+	}
+}
+
+// Pipeline stages where updates can be dropped.
+const (
+	dropStageWSClient  = "ws_client"  // streaming client not keeping up
+	dropStageExporter  = "exporter"   // exporter returning an error
+	dropStageThrottle  = "throttle"   // superseded by a newer update before being sent
+	dropStageDedup     = "dedup"      // duplicate of the previous received payload
+	dropStageRateLimit = "rate_limit" // superseded while the receiver rate limit was exceeded
+	dropStagePriority  = "priority"   // field supplied by a higher priority receiver
+	dropStageRateGuard = "rate_guard" // field changing faster than its max rate of change
+)
+
+// droppedUpdates counts updates dropped per stage.
+var droppedUpdates = newCounterSet(dropStageWSClient, dropStageExporter, dropStageThrottle, dropStageDedup, dropStageRateLimit, dropStagePriority, dropStageRateGuard)
+
+// countDropped records an update dropped at stage.
+func countDropped(stage string) {
+	droppedUpdates.Inc(stage)
+}
+
+// receivedUpdates counts successfully parsed updates per receive mode, pushed to the WebSocket server, and injected.
+var receivedUpdates = newCounterSet("hds", "ws-pull", "poll", "redis", "kafka", "ws-server", "inject")
+
+// oscPacketsSent and oscSendErrors count the OSC messages sent and failing per address,
+// whether sent alone or in a bundle.
+var (
+	oscPacketsSent = newCounterSet()
+	oscSendErrors  = newCounterSet()
+)
+
+// rateGuardRejected counts the updates rejected by rateGuard per field.
+var rateGuardRejected = newCounterSet()
+
+func init() {
+	registerStats("droppedUpdates", droppedUpdates.Totals)
+	registerStats("rateGuardRejected", rateGuardRejected.Totals)
+	registerStats("receivedUpdates", receivedUpdates.Totals)
+	registerStats("oscPacketsSent", oscPacketsSent.Totals)
+	registerStats("oscSendErrors", oscSendErrors.Totals)
+}
+
+// registerPipelineCollectors registers the pipeline counters on registry.
+func registerPipelineCollectors(registry *prometheus.Registry, namespace string) {
+	registry.MustRegister(
+		newCounterSetCollector(droppedUpdates, namespace, "dropped_updates_total", "Total number of updates dropped in the pipeline", "stage"),
+		newCounterSetCollector(receivedUpdates, namespace, "received_updates_total", "Total number of updates received and parsed", "receiver"),
+		newCounterSetCollector(oscPacketsSent, namespace, "osc_packets_sent_total", "Total number of OSC messages sent, alone or in a bundle", "address"),
+		newCounterSetCollector(oscSendErrors, namespace, "osc_send_errors_total", "Total number of OSC messages failing to send", "address"),
+	)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// summaryLogger forwards updates to the next exporters, and logs a status line every interval
+// with the heart rate of the current session, the update rate, streaming clients and exporter errors.
+type summaryLogger struct {
+	next []exporter
+	// exporters and hub are reported on, hub may be nil without streaming servers
+	exporters []exporter
+	hub       *broadcaster
+
+	lock         sync.Mutex
+	last         healthData
+	sessionStart time.Time
+	hrMin, hrMax int
+	hrSum        int
+	hrSamples    int
+	updates      int
+}
+
+// sessionHRStats is the heart rate of the session cleared by POST /reset.
+type sessionHRStats struct {
+	Min     int     `json:"min"`
+	Avg     float64 `json:"avg"`
+	Max     int     `json:"max"`
+	Samples int     `json:"samples"`
+}
+
+func newSummaryLogger(next []exporter, exporters []exporter, hub *broadcaster) *summaryLogger {
+	s := &summaryLogger{next: next, exporters: exporters, hub: hub}
+	registerReset("summary", s.reset)
+	return s
+}
+
+// reset clears the session heart rate, returning it or nil if there was none.
+func (s *summaryLogger) reset(bool) any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.hrSamples == 0 {
+		return nil
+	}
+	cleared := sessionHRStats{Min: s.hrMin, Avg: float64(s.hrSum) / float64(s.hrSamples), Max: s.hrMax, Samples: s.hrSamples}
+	s.hrSamples, s.hrSum = 0, 0
+	return cleared
+}
+
+func (s *summaryLogger) Update(data healthData, updatedKey string) error {
+	s.lock.Lock()
+	s.last = data
+	s.updates++
+	if !data.SessionStart.Equal(s.sessionStart) {
+		s.sessionStart = data.SessionStart
+		s.hrSamples, s.hrSum = 0, 0
+	}
+	if (updatedKey == "heartRate" || updatedKey == "all") && data.HeartRate > 0 {
+		if s.hrSamples == 0 {
+			s.hrMin, s.hrMax = data.HeartRate, data.HeartRate
+		}
+		s.hrMin, s.hrMax = min(s.hrMin, data.HeartRate), max(s.hrMax, data.HeartRate)
+		s.hrSum += data.HeartRate
+		s.hrSamples++
+	}
+	s.lock.Unlock()
+
+	sendToExporters(s.next, data, updatedKey)
+	return nil
+}
+
+// run logs the summary every interval until ctx is cancelled.
+func (s *summaryLogger) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.log(interval)
+		}
+	}
+}
+
+func (s *summaryLogger) log(interval time.Duration) {
+	s.lock.Lock()
+	last, updates := s.last, s.updates
+	hrMin, hrMax, hrSum, hrSamples := s.hrMin, s.hrMax, s.hrSum, s.hrSamples
+	s.updates = 0
+	s.lock.Unlock()
+
+	attrs := []any{"updatesPerSec", float64(updates) / interval.Seconds()}
+	if isStale(last.Time) {
+		attrs = append(attrs, "hr", "stale")
+	} else {
+		attrs = append(attrs, "hr", last.HeartRate)
+	}
+	if hrSamples > 0 {
+		attrs = append(attrs, "sessionMin", hrMin, "sessionMax", hrMax, "sessionAvg", hrSum/hrSamples,
+			"session", last.SessionDuration().Round(time.Second))
+	}
+	if s.hub != nil {
+		attrs = append(attrs, "clients", s.hub.Clients())
+	}
+	var failing []string
+	for _, e := range s.exporters {
+		if r, ok := e.(healthReporter); ok {
+			if h := r.Health(); h.ConsecutiveFailures > 0 {
+				failing = append(failing, h.Type)
+			}
+		}
+	}
+	attrs = append(attrs, "exporterErrors", len(failing))
+	if len(failing) > 0 {
+		attrs = append(attrs, "failing", failing)
+	}
+	slog.Info("Summary", attrs...)
+}
@@ -35,6 +35,23 @@ func init() {
 	}
 }
 
+// versionInfo is the structured version, as printed by -version.
+type versionInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Dirty     bool   `json:"dirty"`
+	BuildTime string `json:"buildTime"`
+}
+
+func GetVersionInfo() versionInfo {
+	return versionInfo{
+		Version:   version,
+		Revision:  revision,
+		Dirty:     buildDirty,
+		BuildTime: buildTime,
+	}
+}
+
 func GetFormattedVersion() string {
 	revisionMeta := revision +
 		lo.Ternary(buildDirty, "+dirty", "") +
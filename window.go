@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// hrWindowStats is the heart rate over the last -stats-window, in the payload and GET /stats.
+type hrWindowStats struct {
+	WindowSeconds float64 `json:"windowSeconds"`
+	Min           float64 `json:"min"`
+	Avg           float64 `json:"avg"`
+	Max           float64 `json:"max"`
+	Samples       int     `json:"samples"`
+}
+
+type hrSample struct {
+	t     time.Time
+	value float64
+}
+
+// hrWindowAggregator sets healthData.HeartRateWindow to the min, average and max of the heart
+// rate samples received within the window before the latest data. Unlike the session stats,
+// this is bounded by time only, so it keeps following the heart rate in long sessions.
+type hrWindowAggregator struct {
+	next   []exporter
+	window time.Duration
+
+	// samples is a ring buffer of size entries from start, in time order, grown when full
+	lock    sync.Mutex
+	samples []hrSample
+	start   int
+	size    int
+	latest  *hrWindowStats
+}
+
+func newHRWindowAggregator(next []exporter, window time.Duration) *hrWindowAggregator {
+	a := &hrWindowAggregator{next: next, window: window, samples: make([]hrSample, 64)}
+	registerStats("heartRateWindow", a.stats)
+	registerReset("heartRateWindow", a.reset)
+	return a
+}
+
+// add appends s, unless it is not newer than the last sample, e.g. repeated in an "all" update.
+func (a *hrWindowAggregator) add(s hrSample) {
+	if a.size > 0 && !s.t.After(a.samples[(a.start+a.size-1)%len(a.samples)].t) {
+		return
+	}
+	if a.size == len(a.samples) {
+		grown := make([]hrSample, 2*len(a.samples))
+		for i := range a.size {
+			grown[i] = a.samples[(a.start+i)%len(a.samples)]
+		}
+		a.samples, a.start = grown, 0
+	}
+	a.samples[(a.start+a.size)%len(a.samples)] = s
+	a.size++
+}
+
+// evict removes the samples older than the window before now.
+func (a *hrWindowAggregator) evict(now time.Time) {
+	for a.size > 0 && now.Sub(a.samples[a.start].t) > a.window {
+		a.start = (a.start + 1) % len(a.samples)
+		a.size--
+	}
+}
+
+// compute returns the stats of the samples in the window, or nil if there are none.
+func (a *hrWindowAggregator) compute() *hrWindowStats {
+	if a.size == 0 {
+		return nil
+	}
+	stats := &hrWindowStats{WindowSeconds: a.window.Seconds(), Samples: a.size}
+	var sum float64
+	for i := range a.size {
+		v := a.samples[(a.start+i)%len(a.samples)].value
+		if i == 0 {
+			stats.Min, stats.Max = v, v
+		}
+		stats.Min = min(stats.Min, v)
+		stats.Max = max(stats.Max, v)
+		sum += v
+	}
+	stats.Avg = sum / float64(a.size)
+	return stats
+}
+
+func (a *hrWindowAggregator) Update(data healthData, updatedKey string) error {
+	a.lock.Lock()
+	if updatedKey != disconnectedKey {
+		if updatedKey == "heartRate" || (updatedKey == "all" && !data.KeyTimes.HeartRate.IsZero()) {
+			a.add(hrSample{t: data.KeyTimes.HeartRate, value: data.HeartRateValue()})
+		}
+		a.evict(data.Time)
+		a.latest = a.compute()
+	}
+	data.HeartRateWindow = a.latest
+	a.lock.Unlock()
+
+	sendToExporters(a.next, data, updatedKey)
+	return nil
+}
+
+// reset clears the samples, returning the last stats or nil if there were none.
+func (a *hrWindowAggregator) reset(bool) any {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	cleared := a.latest
+	a.start, a.size, a.latest = 0, 0, nil
+	if cleared == nil {
+		return nil
+	}
+	return *cleared
+}
+
+func (a *hrWindowAggregator) stats() any {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.latest == nil {
+		return hrWindowStats{WindowSeconds: a.window.Seconds()}
+	}
+	return *a.latest
+}